@@ -0,0 +1,181 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//ErrAmznMtlsClientcertMustBeValid is returned when the X-Amzn-Mtls-Clientcert* headers cannot be parsed.
+var ErrAmznMtlsClientcertMustBeValid = errors.New("proxyheaders: X-Amzn-Mtls-Clientcert headers must be valid")
+
+//albHeaders are the mutual TLS headers of the AWS Application Load Balancer.
+var albHeaders = []string{
+	"X-Amzn-Mtls-Clientcert",
+	"X-Amzn-Mtls-Clientcert-Serial-Number",
+	"X-Amzn-Mtls-Clientcert-Issuer",
+	"X-Amzn-Mtls-Clientcert-Subject",
+	"X-Amzn-Mtls-Clientcert-Validity",
+	"X-Amzn-Mtls-Clientcert-Leaf",
+}
+
+//AWSALB is the Preset for requests proxied by the AWS Application Load Balancer.
+//
+//The client address comes from X-Forwarded-For, the protocol from X-Forwarded-Proto and the port from X-Forwarded-Port.
+//The ALB sends no X-Forwarded-Host, the Host header is the one the client sent. The trace ID (X-Amzn-Trace-Id), that the
+//ALB adds or extends with its own segment, is available with Attribute, as AttrTraceID, and left in the request so the
+//X-Ray SDK continues the trace.
+//
+//With mutual TLS in passthrough mode, the client certificate chain (X-Amzn-Mtls-Clientcert) is in http.Request.TLS, and
+//verified if there are Config.ClientCAs. In verify mode, the leaf certificate (X-Amzn-Mtls-Clientcert-Leaf) is in
+//http.Request.TLS and its fields as verified by the ALB (X-Amzn-Mtls-Clientcert-Subject, -Issuer, -Serial-Number and
+//-Validity) are available with Identity.
+type AWSALB struct {
+	//Ranges are the load balancer addresses trusted to send the headers, usually its subnets. As AWS does not publish them,
+	//if nil only Config.TrustedProxies are trusted, and if both are nil every peer is: any client reaching the application
+	//directly can then send X-Amzn-Mtls-Clientcert-* headers asserting a verified identity.
+	Ranges *PrefixSet
+}
+
+//Name returns "aws-alb".
+func (AWSALB) Name() string {
+	return "aws-alb"
+}
+
+//Headers returns the ALB mutual TLS headers and the X-Forwarded-* ones.
+func (AWSALB) Headers() []string {
+	return append(append([]string(nil), albHeaders...), forwardingHeaders...)
+}
+
+//TrustedProxies returns the ALB ranges.
+func (p AWSALB) TrustedProxies() *PrefixSet {
+	return p.Ranges
+}
+
+//Extract reads the ALB headers. X-Forwarded-For and X-Forwarded-Proto are required.
+func (AWSALB) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff == "" {
+		return nil, ErrMustHaveXForwardedFor
+	}
+	if fw.For, err = c.ParseHops(xff); err != nil {
+		return nil, err
+	}
+	if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Proto == "" {
+		return nil, ErrMustHaveXForwardedProto
+	}
+	if fw.Port, err = c.Header(r.Header, "X-Forwarded-Port"); err != nil {
+		return nil, err
+	}
+	trace, err := c.Header(r.Header, "X-Amzn-Trace-Id")
+	if err != nil {
+		return nil, err
+	}
+	fw.setAttribute(AttrTraceID, trace)
+
+	//Read the mutual TLS headers, all of them at once, as single values.
+	v := make(map[string]string, len(albHeaders))
+	for _, h := range albHeaders {
+		if v[h], err = c.Header(r.Header, h); err != nil {
+			return nil, err
+		}
+	}
+
+	//Passthrough mode sends the whole chain, verify mode only the leaf.
+	certs := v["X-Amzn-Mtls-Clientcert"]
+	if certs == "" {
+		certs = v["X-Amzn-Mtls-Clientcert-Leaf"]
+	}
+	if certs != "" {
+		if fw.Certificates, err = parseURLEncodedPEMCertificates(certs, ErrAmznMtlsClientcertMustBeValid); err != nil {
+			return nil, err
+		}
+	}
+
+	//Verify mode sends the fields of the certificate verified by the ALB.
+	if v["X-Amzn-Mtls-Clientcert-Subject"] == "" {
+		return fw, nil
+	}
+	fw.Identity = &ClientIdentity{
+		Subject:      v["X-Amzn-Mtls-Clientcert-Subject"],
+		Issuer:       v["X-Amzn-Mtls-Clientcert-Issuer"],
+		SerialNumber: strings.ToUpper(v["X-Amzn-Mtls-Clientcert-Serial-Number"]),
+		Verified:     true,
+	}
+	if fw.Identity.SubjectName, err = ParseDistinguishedName(fw.Identity.Subject); err != nil {
+		return nil, ErrAmznMtlsClientcertMustBeValid
+	}
+	if fw.Identity.Issuer != "" {
+		if fw.Identity.IssuerName, err = ParseDistinguishedName(fw.Identity.Issuer); err != nil {
+			return nil, ErrAmznMtlsClientcertMustBeValid
+		}
+	}
+	if fw.Identity.NotBefore, fw.Identity.NotAfter, err = parseALBValidity(v["X-Amzn-Mtls-Clientcert-Validity"]); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+//parseURLEncodedPEMCertificates decodes URL-encoded PEM certificates, returning errInvalid if they are malformed.
+//Plus signs are kept, as they are part of base64.
+func parseURLEncodedPEMCertificates(s string, errInvalid error) ([]*x509.Certificate, error) {
+	s, err := url.PathUnescape(s)
+	if err != nil {
+		return nil, errInvalid
+	}
+	certs, err := parsePEMCertificates(s)
+	if err != nil || len(certs) == 0 {
+		return nil, errInvalid
+	}
+	return certs, nil
+}
+
+//parseALBValidity parses the X-Amzn-Mtls-Clientcert-Validity, like "NotBefore=2023-09-21T01:50:17Z;NotAfter=2024-09-20T01:50:16Z".
+//An empty s results in zero times.
+func parseALBValidity(s string) (notBefore, notAfter time.Time, err error) {
+	if s == "" {
+		return notBefore, notAfter, nil
+	}
+	for _, kv := range strings.Split(s, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		var t *time.Time
+		switch k {
+		case "NotBefore":
+			t = &notBefore
+		case "NotAfter":
+			t = &notAfter
+		default:
+			return time.Time{}, time.Time{}, ErrAmznMtlsClientcertMustBeValid
+		}
+		if *t, err = time.Parse(time.RFC3339, v); err != nil {
+			return time.Time{}, time.Time{}, ErrAmznMtlsClientcertMustBeValid
+		}
+	}
+	return notBefore, notAfter, nil
+}
@@ -0,0 +1,176 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestAWSALB(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.AWSALB{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.1.5:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Port", "8443")
+	req.Header.Add("X-Amzn-Trace-Id", "Root=1-67891233-abcdef012345678912345678")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.7", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "www.example.com:8443", pr.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "https", pr.URL.Scheme; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "Root=1-67891233-abcdef012345678912345678", proxyheaders.Attribute(pr, proxyheaders.AttrTraceID); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "Root=1-67891233-abcdef012345678912345678", pr.Header.Get("X-Amzn-Trace-Id"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "aws-alb", proxyheaders.PresetName(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := proxyheaders.FieldClientIP|proxyheaders.FieldProto, proxyheaders.AssertedFields(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := (*proxyheaders.ClientIdentity)(nil), proxyheaders.Identity(pr); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	//There is no X-Forwarded-Host, but X-Forwarded-For is still required.
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.1.5:40000"
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Port", "8443")
+	req.Header.Add("X-Amzn-Trace-Id", "Root=1-67891233-abcdef012345678912345678")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrMustHaveXForwardedFor, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestAWSALB_passthrough(t *testing.T) {
+	ca, caKey := newCert(t, "ca", true, nil, nil)
+	leaf, _ := newCert(t, "client", false, ca, caKey)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	c := &proxyheaders.Config{Preset: proxyheaders.AWSALB{}, ClientCAs: pool}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.1.5:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Port", "8443")
+	req.Header.Add("X-Amzn-Trace-Id", "Root=1-67891233-abcdef012345678912345678")
+	req.Header.Add("X-Amzn-Mtls-Clientcert", url.PathEscape(pemEncode(leaf)))
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := true, certificatesAreEqual([]*x509.Certificate{leaf}, pr.TLS.PeerCertificates); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	id := proxyheaders.Identity(pr)
+	if want, got := "CN=client", id.Subject; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "CN=ca", id.Issuer; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := true, id.Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := true, proxyheaders.AssertedFields(pr).Has(proxyheaders.FieldClientCert); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "", pr.Header.Get("X-Amzn-Mtls-Clientcert"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.1.5:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Port", "8443")
+	req.Header.Add("X-Amzn-Trace-Id", "Root=1-67891233-abcdef012345678912345678")
+	req.Header.Add("X-Amzn-Mtls-Clientcert", "-----BEGIN%20CERTIFICATE-----%0AAAAA")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrAmznMtlsClientcertMustBeValid, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestAWSALB_verify(t *testing.T) {
+	ca, caKey := newCert(t, "ca", true, nil, nil)
+	leaf, _ := newCert(t, "client", false, ca, caKey)
+	c := &proxyheaders.Config{Preset: proxyheaders.AWSALB{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.1.5:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Port", "8443")
+	req.Header.Add("X-Amzn-Trace-Id", "Root=1-67891233-abcdef012345678912345678")
+	req.Header.Add("X-Amzn-Mtls-Clientcert-Leaf", url.PathEscape(pemEncode(leaf)))
+	req.Header.Add("X-Amzn-Mtls-Clientcert-Subject", "CN=client.example.com,O=Example")
+	req.Header.Add("X-Amzn-Mtls-Clientcert-Issuer", "CN=Example CA,O=Example")
+	req.Header.Add("X-Amzn-Mtls-Clientcert-Serial-Number", "03a5b1")
+	req.Header.Add("X-Amzn-Mtls-Clientcert-Validity", "NotBefore=2023-09-21T01:50:17Z;NotAfter=2024-09-20T01:50:16Z")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := 1, len(pr.TLS.PeerCertificates); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	id := proxyheaders.Identity(pr)
+	if want, got := "CN=client.example.com,O=Example", id.Subject; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "CN=Example CA,O=Example", id.Issuer; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "03A5B1", id.SerialNumber; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := time.Date(2024, 9, 20, 1, 50, 16, 0, time.UTC), id.NotAfter; !want.Equal(got) {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := true, id.Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	req.Header.Set("X-Amzn-Mtls-Clientcert-Validity", "NotBefore=yesterday")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := true, errors.Is(err, proxyheaders.ErrAmznMtlsClientcertMustBeValid); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+}
@@ -0,0 +1,202 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+//AttrProxies are the trusted proxies traversed by the request, nearest first, separated by ", ", like the Apache
+//RemoteIPProxiesHeader.
+const AttrProxies = "proxies"
+
+//apacheIntranet are the addresses mod_remoteip does not accept from a RemoteIPTrustedProxy, besides the IPv6 ones
+//outside 2000::/3.
+var apacheIntranet = NewPrefixSet(
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+)
+
+//apachePublicIPv6 is the IPv6 global unicast block.
+var apachePublicIPv6 = netip.MustParsePrefix("2000::/3")
+
+//ApacheRemoteIP is the Preset that reproduces the client address of the Apache mod_remoteip module, so the addresses match
+//the ones of an Apache configured with:
+//
+//	RemoteIPHeader         <Header>
+//	RemoteIPInternalProxy  <Internal>
+//	RemoteIPTrustedProxy   <Trusted>
+//	RemoteIPProxiesHeader  <ProxiesHeader>
+//
+//While the current address (starting with the peer) is a proxy, the last entry of Header is taken as the new current
+//address and removed, so the client is the first address not presented by a proxy. A RemoteIPInternalProxy may present any
+//address, but a RemoteIPTrustedProxy (or an internal one presented by it, as it is then treated as trusted) may not present
+//intranet addresses (10/8, 172.16/12, 192.168/16, 169.254/16, 127/8 and
+//IPv6 outside 2000::/3): the search stops at them, like at entries that are not IP addresses. If neither Internal nor
+//Trusted are set, every address is a trusted proxy, like in Apache. When the peer is a proxy, the optional
+//X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Port are used as well.
+//
+//Like mod_remoteip, the entries of Header that were not taken are kept in it, in the resolved request.
+//
+//The trusted proxies traversed (never the internal ones, unless treated as trusted), nearest first, are available with
+//Attribute, as AttrProxies, and in ProxiesHeader, if set.
+//
+//TrustedProxies is nil, as Extract checks Internal and Trusted itself: like in Apache, the request of a peer that is
+//neither keeps the peer address instead of being rejected, unless Config.TrustedProxies is set.
+type ApacheRemoteIP struct {
+	//Header is the RemoteIPHeader. If empty, "X-Forwarded-For" is used.
+	Header string
+	//Internal are the RemoteIPInternalProxy addresses.
+	Internal *PrefixSet
+	//Trusted are the RemoteIPTrustedProxy addresses.
+	Trusted *PrefixSet
+	//ProxiesHeader is the RemoteIPProxiesHeader, the header of the resolved request with the trusted proxies traversed.
+	//If empty, they are only available with Attribute.
+	ProxiesHeader string
+}
+
+//Name returns "apache".
+func (ApacheRemoteIP) Name() string {
+	return "apache"
+}
+
+//Headers returns the RemoteIPHeader, the RemoteIPProxiesHeader and the X-Forwarded-* headers.
+func (p ApacheRemoteIP) Headers() []string {
+	var headers []string
+	for _, h := range []string{p.Header, p.ProxiesHeader} {
+		if h != "" {
+			headers = append(headers, h)
+		}
+	}
+	return append(headers, forwardingHeaders...)
+}
+
+//TrustedProxies returns nil, as the peer is checked against Internal and Trusted by Extract.
+func (ApacheRemoteIP) TrustedProxies() *PrefixSet {
+	return nil
+}
+
+//Extract selects the client like the Apache mod_remoteip module. No header is required.
+func (p ApacheRemoteIP) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+	peer, err := ParseHop(r.RemoteAddr)
+	if err != nil || !peer.HasAddr() {
+		return fw, nil
+	}
+
+	header := p.Header
+	if header == "" {
+		header = "X-Forwarded-For"
+	}
+	list, err := c.ListHeader(r.Header, header)
+	if err != nil {
+		return nil, err
+	}
+	var proxies, remaining []string
+	fw.For, fw.Client, proxies, remaining = p.remoteIP(peer.Addr, list)
+	fw.Header = http.Header{}
+	if len(remaining) > 0 {
+		fw.Header.Set(header, strings.Join(remaining, ", "))
+	}
+	if _, ok := p.proxy(peer.Addr); !ok {
+		return fw, nil
+	}
+	if len(proxies) > 0 {
+		fw.setAttribute(AttrProxies, strings.Join(proxies, ", "))
+		if p.ProxiesHeader != "" {
+			fw.Header.Set(p.ProxiesHeader, strings.Join(proxies, ", "))
+		}
+	}
+
+	if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Host, err = c.Header(r.Header, "X-Forwarded-Host"); err != nil {
+		return nil, err
+	}
+	if fw.Port, err = c.Header(r.Header, "X-Forwarded-Port"); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+//remoteIP walks the list from the right like mod_remoteip, returning the addresses taken (from the left), the client (an
+//invalid hop if the peer is kept), the trusted proxies traversed, nearest first, and the entries not taken.
+func (p ApacheRemoteIP) remoteIP(current netip.Addr, list string) ([]Hop, Hop, []string, []string) {
+	var entries []string
+	if strings.TrimSpace(list) != "" {
+		entries = strings.Split(list, ",")
+		for i := range entries {
+			entries[i] = strings.TrimSpace(entries[i])
+		}
+	}
+	var taken []Hop
+	var proxies []string
+	client := Hop{}
+	//external is set once a trusted proxy is traversed: like in mod_remoteip, an internal proxy presented by it is treated as
+	//a trusted one, as its address was not observed by an internal proxy.
+	external := false
+	i := len(entries) - 1
+	for ; i >= 0; i-- {
+		internal, ok := p.proxy(current)
+		if !ok {
+			break
+		}
+		internal = internal && !external
+		external = !internal
+		addr, err := netip.ParseAddr(entries[i])
+		if err != nil {
+			break
+		}
+		addr = addr.Unmap()
+		if !internal && apacheIntranetAddr(addr) {
+			break
+		}
+		if !internal {
+			proxies = append(proxies, current.String())
+		}
+		client = Hop{Kind: HopIP, Addr: addr, Raw: entries[i]}
+		taken = append([]Hop{client}, taken...)
+		current = addr
+	}
+	return taken, client, proxies, entries[:i+1]
+}
+
+//proxy reports if addr is a proxy, and if it is an internal one.
+func (p ApacheRemoteIP) proxy(addr netip.Addr) (internal, ok bool) {
+	switch {
+	case p.Internal == nil && p.Trusted == nil:
+		return false, true
+	case p.Internal.Contains(addr):
+		return true, true
+	case p.Trusted.Contains(addr):
+		return false, true
+	}
+	return false, false
+}
+
+//apacheIntranetAddr reports if addr is an intranet address, not accepted from a RemoteIPTrustedProxy.
+func apacheIntranetAddr(addr netip.Addr) bool {
+	if addr.Is6() {
+		return !apachePublicIPv6.Contains(addr)
+	}
+	return apacheIntranet.Contains(addr)
+}
@@ -0,0 +1,164 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestApacheRemoteIP(t *testing.T) {
+	//RemoteIPInternalProxy 10.0.0.0/8
+	//RemoteIPTrustedProxy  198.51.100.0/24 2001:db8::/32
+	internal, err := proxyheaders.ParsePrefixSet("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := proxyheaders.ParsePrefixSet("198.51.100.0/24", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		peer      string
+		xff       string
+		want      string
+		proxies   string
+		remaining string
+	}{
+		//Peers that are not proxies are kept.
+		{"203.0.113.1:1234", "192.0.2.1", "203.0.113.1:1234", "", "192.0.2.1"},
+		//Internal proxies may present intranet addresses.
+		{"10.0.0.1:1234", "192.168.1.1", "192.168.1.1", "", ""},
+		{"10.0.0.1:1234", "192.0.2.1, 10.0.0.2", "192.0.2.1", "", ""},
+		//Trusted proxies may not: the search stops, keeping the proxy.
+		{"198.51.100.1:1234", "192.168.1.1", "198.51.100.1:1234", "", "192.168.1.1"},
+		{"198.51.100.1:1234", "192.0.2.1", "192.0.2.1", "198.51.100.1", ""},
+		{"198.51.100.1:1234", "fd00::1", "198.51.100.1:1234", "", "fd00::1"},
+		//The chain is walked while the current address is a proxy, recording the trusted ones.
+		{"10.0.0.1:1234", "192.0.2.1, 198.51.100.2", "192.0.2.1", "198.51.100.2", ""},
+		{"198.51.100.1:1234", "192.0.2.1, 2001:db8::1, 198.51.100.2", "192.0.2.1", "198.51.100.1, 198.51.100.2, 2001:db8::1", ""},
+		{"198.51.100.1:1234", "192.0.2.1, 10.0.0.5, 198.51.100.2", "198.51.100.2", "198.51.100.1", "192.0.2.1, 10.0.0.5"},
+		//The client may be followed by addresses that are not taken.
+		{"10.0.0.1:1234", "192.0.2.9, 192.0.2.1", "192.0.2.1", "", "192.0.2.9"},
+		//Entries that are not IP addresses stop the search.
+		{"10.0.0.1:1234", "192.0.2.1, unknown", "10.0.0.1:1234", "", "192.0.2.1, unknown"},
+		{"10.0.0.1:1234", "192.0.2.1:80", "10.0.0.1:1234", "", "192.0.2.1:80"},
+		{"10.0.0.1:1234", "", "10.0.0.1:1234", "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+		req.RemoteAddr = tt.peer
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		req.Header.Set("X-Forwarded-By", "spoofed")
+		c := &proxyheaders.Config{Preset: proxyheaders.ApacheRemoteIP{Internal: internal, Trusted: trusted, ProxiesHeader: "X-Forwarded-By"}}
+		pr, err := c.NewProxiedRequest(req)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("%+v: want=%v, got=%v", tt, want, got)
+		}
+		if want, got := tt.want, pr.RemoteAddr; want != got {
+			t.Fatalf("%+v: want=%s, got=%s", tt, want, got)
+		}
+		if want, got := tt.proxies, proxyheaders.Attribute(pr, proxyheaders.AttrProxies); want != got {
+			t.Fatalf("%+v: want=%s, got=%s", tt, want, got)
+		}
+		if want, got := tt.proxies, pr.Header.Get("X-Forwarded-By"); want != got {
+			t.Fatalf("%+v: want=%s, got=%s", tt, want, got)
+		}
+		//The entries not taken are kept.
+		if want, got := tt.remaining, pr.Header.Get("X-Forwarded-For"); want != got {
+			t.Fatalf("%+v: want=%s, got=%s", tt, want, got)
+		}
+	}
+}
+
+func TestApacheRemoteIP_trustedThenInternal(t *testing.T) {
+	//RemoteIPInternalProxy 203.0.113.0/24
+	//RemoteIPTrustedProxy  198.51.100.0/24
+	internal, err := proxyheaders.ParsePrefixSet("203.0.113.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := proxyheaders.ParsePrefixSet("198.51.100.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		xff       string
+		want      string
+		proxies   string
+		remaining string
+	}{
+		//An internal proxy presented by a trusted one is treated as trusted: it may not present intranet addresses.
+		{"192.168.1.1, 203.0.113.5", "203.0.113.5", "198.51.100.1", "192.168.1.1"},
+		{"192.0.2.1, 203.0.113.5", "192.0.2.1", "198.51.100.1, 203.0.113.5", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		req.Header.Set("X-Forwarded-For", tt.xff)
+		c := &proxyheaders.Config{Preset: proxyheaders.ApacheRemoteIP{Internal: internal, Trusted: trusted}}
+		pr, err := c.NewProxiedRequest(req)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("%+v: want=%v, got=%v", tt, want, got)
+		}
+		if want, got := tt.want, pr.RemoteAddr; want != got {
+			t.Fatalf("%+v: want=%s, got=%s", tt, want, got)
+		}
+		if want, got := tt.proxies, proxyheaders.Attribute(pr, proxyheaders.AttrProxies); want != got {
+			t.Fatalf("%+v: want=%s, got=%s", tt, want, got)
+		}
+		if want, got := tt.remaining, pr.Header.Get("X-Forwarded-For"); want != got {
+			t.Fatalf("%+v: want=%s, got=%s", tt, want, got)
+		}
+	}
+}
+
+func TestApacheRemoteIP_noProxies(t *testing.T) {
+	//Without proxies configured every address is a trusted proxy, that may not present intranet addresses.
+	c := &proxyheaders.Config{Preset: proxyheaders.ApacheRemoteIP{Header: "X-Client-IP"}}
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "203.0.113.1:1234"
+	req.Header.Set("X-Client-IP", "192.0.2.1, 192.168.1.1")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.1:1234", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "192.0.2.1, 192.168.1.1", pr.Header.Get("X-Client-IP"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req.Header.Set("X-Client-IP", "192.168.1.1, 192.0.2.1, 198.51.100.2")
+	if pr, err = c.NewProxiedRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "192.0.2.1", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "203.0.113.1, 198.51.100.2", proxyheaders.Attribute(pr, proxyheaders.AttrProxies); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "192.168.1.1", pr.Header.Get("X-Client-IP"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+}
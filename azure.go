@@ -0,0 +1,154 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+//Errors returned by the Azure preset.
+var (
+	//ErrAzureClientIPMustBeValid is returned when the X-Azure-ClientIP header is not an IP address.
+	ErrAzureClientIPMustBeValid = errors.New("proxyheaders: X-Azure-ClientIP must be an IP address")
+	//ErrAzureFDIDMustMatch is returned when Azure.FrontDoorID is set and the X-Azure-FDID header is absent or different,
+	//meaning the request came from a Front Door of another tenant, or did not come from a Front Door.
+	ErrAzureFDIDMustMatch = errors.New("proxyheaders: X-Azure-FDID must be the configured Front Door ID")
+	//ErrARRClientCertMustBeValid is returned when the X-ARR-ClientCert header is not a base64 DER certificate.
+	ErrARRClientCertMustBeValid = errors.New("proxyheaders: X-ARR-ClientCert must be a base64 DER certificate")
+)
+
+//AttrSocketIP is the address of the connection to the proxy, that may be a proxy itself, like the Azure X-Azure-SocketIP.
+const AttrSocketIP = "socket-ip"
+
+//Azure is the Preset for requests proxied by Azure Front Door or Azure Application Gateway.
+//
+//The client address comes from X-Azure-ClientIP (Front Door) or, if absent, from X-Forwarded-For (Application Gateway).
+//The host comes from X-Forwarded-Host, X-Original-Host (Application Gateway, when the host is rewritten) or, if both are
+//absent, the request Host. The protocol comes from X-Forwarded-Proto and the optional port from X-Forwarded-Port. The socket
+//address (X-Azure-SocketIP) and the reference (X-Azure-Ref) are available with Attribute, as AttrSocketIP and AttrRequestID.
+//
+//The Application Gateway client certificate (X-ARR-ClientCert) is in http.Request.TLS.
+//
+//As the Front Door addresses are shared by all the tenants, checking them is not enough: set FrontDoorID so requests of the
+//Front Doors of other tenants are rejected with ErrAzureFDIDMustMatch. The zero Azure (as returned by PresetByName) trusts
+//every peer and checks no ID, so Config.Validate rejects it: set FrontDoorID or, for an Application Gateway, its subnet in
+//Ranges or Config.TrustedProxies.
+type Azure struct {
+	//FrontDoorID is the ID of the Front Door, matched case-insensitively against X-Azure-FDID. If empty, it is not checked,
+	//like for an Application Gateway, that does not send it.
+	FrontDoorID string
+	//Ranges are the Azure addresses trusted to send the headers, like the AzureFrontDoor.Backend service tag or the
+	//Application Gateway subnet. Azure publishes the service tags in a weekly download, not embedded in this package.
+	Ranges *PrefixSet
+}
+
+//Name returns "azure".
+func (Azure) Name() string {
+	return "azure"
+}
+
+//Headers returns the Azure headers and the X-Forwarded-* ones.
+func (Azure) Headers() []string {
+	return append([]string{"X-Azure-ClientIP", "X-Azure-SocketIP", "X-Azure-FDID", "X-Original-Host", "X-ARR-ClientCert"},
+		forwardingHeaders...)
+}
+
+//TrustedProxies returns the Azure ranges.
+func (p Azure) TrustedProxies() *PrefixSet {
+	return p.Ranges
+}
+
+//Extract reads the Azure headers. X-Forwarded-Proto, and X-Azure-ClientIP or X-Forwarded-For, are required, as is
+//X-Azure-FDID when FrontDoorID is set.
+func (p Azure) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+
+	//Requests from other Front Doors must not get through.
+	if p.FrontDoorID != "" {
+		fdid, err := c.Header(r.Header, "X-Azure-FDID")
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(strings.TrimSpace(fdid), strings.TrimSpace(p.FrontDoorID)) {
+			return nil, ErrAzureFDIDMustMatch
+		}
+	}
+
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff != "" {
+		if fw.For, err = c.ParseHops(xff); err != nil {
+			return nil, err
+		}
+	}
+	cip, err := c.Header(r.Header, "X-Azure-ClientIP")
+	if err != nil {
+		return nil, err
+	}
+	if cip != "" {
+		if fw.Client, err = ParseHop(cip); err != nil || fw.Client.Kind != HopIP {
+			return nil, ErrAzureClientIPMustBeValid
+		}
+	} else if len(fw.For) == 0 {
+		return nil, ErrMustHaveXForwardedFor
+	}
+
+	if fw.Host, err = c.Header(r.Header, "X-Forwarded-Host"); err != nil {
+		return nil, err
+	}
+	if fw.Host == "" {
+		if fw.Host, err = c.Header(r.Header, "X-Original-Host"); err != nil {
+			return nil, err
+		}
+	}
+	if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Proto == "" {
+		return nil, ErrMustHaveXForwardedProto
+	}
+	if fw.Port, err = c.Header(r.Header, "X-Forwarded-Port"); err != nil {
+		return nil, err
+	}
+
+	socket, err := c.Header(r.Header, "X-Azure-SocketIP")
+	if err != nil {
+		return nil, err
+	}
+	fw.setAttribute(AttrSocketIP, socket)
+	ref, err := c.Header(r.Header, "X-Azure-Ref")
+	if err != nil {
+		return nil, err
+	}
+	fw.setAttribute(AttrRequestID, ref)
+
+	arr, err := c.Header(r.Header, "X-ARR-ClientCert")
+	if err != nil {
+		return nil, err
+	}
+	if arr != "" {
+		cert, err := parseBase64DERCertificate(arr, ErrARRClientCertMustBeValid)
+		if err != nil {
+			return nil, err
+		}
+		fw.Certificates = append(fw.Certificates, cert)
+	}
+	return fw, nil
+}
@@ -0,0 +1,156 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+const testFrontDoorID = "8f3a2b1c-1234-4cde-9f00-0123456789ab"
+
+func TestAzure_frontDoor(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.Azure{FrontDoorID: testFrontDoorID}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://origin.azurewebsites.net/", nil)
+	req.RemoteAddr = "147.243.1.1:40000"
+	req.Header.Add("X-Azure-ClientIP", "203.0.113.7")
+	req.Header.Add("X-Azure-SocketIP", "198.51.100.1")
+	req.Header.Add("X-Azure-FDID", testFrontDoorID)
+	req.Header.Add("X-Azure-Ref", "0zxV+XAAAAABKMMOjBv2NT4TY6SQVjC0zV1NURURHRTA2MTkANDM3YzgyY2QtMzYwYS00YTU0LTk0YzMtNWZmNzA3NjQ3Nzgz")
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.7", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "www.example.com", pr.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "198.51.100.1", proxyheaders.Attribute(pr, proxyheaders.AttrSocketIP); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "azure", proxyheaders.PresetName(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "", pr.Header.Get("X-Azure-FDID"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//The Front Door ID is case-insensitive...
+	req = httptest.NewRequest(http.MethodGet, "http://origin.azurewebsites.net/", nil)
+	req.RemoteAddr = "147.243.1.1:40000"
+	req.Header.Add("X-Azure-ClientIP", "203.0.113.7")
+	req.Header.Add("X-Azure-SocketIP", "198.51.100.1")
+	req.Header.Add("X-Azure-FDID", testFrontDoorID)
+	req.Header.Add("X-Azure-Ref", "0zxV+XAAAAABKMMOjBv2NT4TY6SQVjC0zV1NURURHRTA2MTkANDM3YzgyY2QtMzYwYS00YTU0LTk0YzMtNWZmNzA3NjQ3Nzgz")
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Azure-FDID", "8F3A2B1C-1234-4CDE-9F00-0123456789AB")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	//...but Front Doors of other tenants are rejected.
+	for _, fdid := range []string{"00000000-0000-0000-0000-000000000000", ""} {
+		req = httptest.NewRequest(http.MethodGet, "http://origin.azurewebsites.net/", nil)
+		req.RemoteAddr = "147.243.1.1:40000"
+		req.Header.Add("X-Azure-ClientIP", "203.0.113.7")
+		req.Header.Add("X-Azure-SocketIP", "198.51.100.1")
+		req.Header.Add("X-Azure-FDID", testFrontDoorID)
+		req.Header.Add("X-Azure-Ref", "0zxV+XAAAAABKMMOjBv2NT4TY6SQVjC0zV1NURURHRTA2MTkANDM3YzgyY2QtMzYwYS00YTU0LTk0YzMtNWZmNzA3NjQ3Nzgz")
+		req.Header.Add("X-Forwarded-For", "203.0.113.7")
+		req.Header.Add("X-Forwarded-Host", "www.example.com")
+		req.Header.Add("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Azure-FDID", fdid)
+		_, err = c.NewProxiedRequest(req)
+		if want, got := proxyheaders.ErrAzureFDIDMustMatch, err; want != got {
+			t.Fatalf("fdid=%s: want=%v, got=%v", fdid, want, got)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://origin.azurewebsites.net/", nil)
+	req.RemoteAddr = "147.243.1.1:40000"
+	req.Header.Add("X-Azure-ClientIP", "203.0.113.7")
+	req.Header.Add("X-Azure-SocketIP", "198.51.100.1")
+	req.Header.Add("X-Azure-FDID", testFrontDoorID)
+	req.Header.Add("X-Azure-Ref", "0zxV+XAAAAABKMMOjBv2NT4TY6SQVjC0zV1NURURHRTA2MTkANDM3YzgyY2QtMzYwYS00YTU0LTk0YzMtNWZmNzA3NjQ3Nzgz")
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Azure-ClientIP", "unknown")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrAzureClientIPMustBeValid, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestAzure_applicationGateway(t *testing.T) {
+	ca, caKey := newCert(t, "ca", true, nil, nil)
+	leaf, _ := newCert(t, "client", false, ca, caKey)
+	c := &proxyheaders.Config{Preset: proxyheaders.Azure{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://backend.internal/", nil)
+	req.RemoteAddr = "10.1.0.4:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7:51234")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Port", "443")
+	req.Header.Add("X-Original-Host", "www.example.com")
+	req.Header.Add("X-ARR-ClientCert", base64.StdEncoding.EncodeToString(leaf.Raw))
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.7:51234", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "www.example.com", pr.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := true, certificatesAreEqual([]*x509.Certificate{leaf}, pr.TLS.PeerCertificates); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "CN=client", proxyheaders.Identity(pr).Subject; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "", pr.Header.Get("X-Original-Host"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req.Header.Set("X-ARR-ClientCert", "not base64")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrARRClientCertMustBeValid, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	req.Header.Del("X-ARR-ClientCert")
+	req.Header.Del("X-Forwarded-For")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrMustHaveXForwardedFor, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
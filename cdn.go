@@ -0,0 +1,305 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	_ "embed" //Needed for go:embed.
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//Errors returned by the CDN presets.
+var (
+	//ErrClientIPHeaderMustBeValid is returned when the client address header of a CDN (like Fastly-Client-IP) is not an
+	//IP address. The actual error returned wraps this one, with the header name.
+	ErrClientIPHeaderMustBeValid = errors.New("proxyheaders: client IP header must be an IP address")
+	//ErrHopCountHeaderMustBeValid is returned when the hop count header of a CDN (like Akamai-Origin-Hop) is not a positive
+	//number. The actual error returned wraps this one, with the header name.
+	ErrHopCountHeaderMustBeValid = errors.New("proxyheaders: hop count header must be a positive number")
+	//ErrClientCertHeaderMustBeValid is returned when the client certificate header of a CDN is not in its CertFormat. The
+	//actual error returned wraps this one, with the header name.
+	ErrClientCertHeaderMustBeValid = errors.New("proxyheaders: client certificate header must be in the certificate format")
+	//ErrMustHaveRequiredHeader is returned when the header of a field Required by a CDN is absent. The actual error
+	//returned wraps this one, with the header name.
+	ErrMustHaveRequiredHeader = errors.New("proxyheaders: must have the header of a required field")
+)
+
+//The IP ranges published by Fastly in https://api.fastly.com/public-ip-list.
+var (
+	//go:embed ranges/fastly-ips.txt
+	fastlyIPs []byte
+
+	fastlyRanges = mustReadPrefixList(fastlyIPs)
+)
+
+//FastlyRanges returns the Fastly IP ranges embedded in this package. The returned set is shared and must not be modified.
+func FastlyRanges() *PrefixSet {
+	return fastlyRanges
+}
+
+//CDN is a configurable Preset for CDNs that inform the client address and the protocol in headers of their own.
+//
+//The client address comes from ClientIPHeader or, if absent in the request, from X-Forwarded-For. Unless HostHeader is set,
+//the Host header is the one the client sent. Each header is optional, but the client address (ClientIPHeader or
+//X-Forwarded-For) and the fields in Required. Fastly and Akamai are CDN presets already configured.
+type CDN struct {
+	//ID is the name of the preset, returned by Name.
+	ID string
+	//ClientIPHeader is the header with the client address, like "True-Client-IP".
+	ClientIPHeader string
+	//HopCountHeader is the header with the number of CDN servers the request passed through, each one appending the address
+	//it received the request from to X-Forwarded-For, like "Akamai-Origin-Hop". If set and ClientIPHeader is absent in a
+	//request, the client is this number of entries from the right of X-Forwarded-For, instead of selected with the trusted proxies.
+	HopCountHeader string
+	//SecureHeader is the header informing the client used TLS, like "Fastly-SSL", with any value but "0", "false" or "off".
+	//If set, the protocol is "https" when it is present and "http" when it is absent.
+	SecureHeader string
+	//ProtoHeader is the header with the protocol, when SecureHeader is not set. If empty, "X-Forwarded-Proto" is used. If
+	//absent in a request, the protocol of the request is kept.
+	ProtoHeader string
+	//CountryHeader is the header with the client country, available with Attribute as AttrCountry.
+	CountryHeader string
+	//HostHeader is the header with the host the client asked for, like "X-Forwarded-Host". If empty, or absent in a
+	//request, the request Host is kept.
+	HostHeader string
+	//PortHeader is the header with the port the client connected to, like "X-Forwarded-Port".
+	PortHeader string
+	//ClientCertHeader is the header with the client certificates, in ClientCertFormat, for the CDNs terminating mutual TLS.
+	ClientCertHeader string
+	//ClientCertFormat is the encoding of ClientCertHeader.
+	ClientCertFormat CertFormat
+	//Required are the fields whose header must be present, returning ErrMustHaveRequiredHeader if absent: FieldHost
+	//(HostHeader), FieldProto (ProtoHeader, as SecureHeader is only present for TLS) and FieldClientCert (ClientCertHeader).
+	//The client address is always required.
+	Required Field
+	//Ranges are the CDN addresses trusted to send the headers, usually from the list the CDN publishes.
+	Ranges *PrefixSet
+}
+
+//Name returns ID.
+func (p CDN) Name() string {
+	return p.ID
+}
+
+//Headers returns the configured headers and the X-Forwarded-* ones.
+func (p CDN) Headers() []string {
+	var headers []string
+	for _, h := range []string{p.ClientIPHeader, p.HopCountHeader, p.SecureHeader, p.ProtoHeader, p.CountryHeader, p.HostHeader,
+		p.PortHeader, p.ClientCertHeader} {
+		if h != "" {
+			headers = append(headers, h)
+		}
+	}
+	return append(headers, forwardingHeaders...)
+}
+
+//TrustedProxies returns the CDN ranges.
+func (p CDN) TrustedProxies() *PrefixSet {
+	return p.Ranges
+}
+
+//Extract reads the configured headers. ClientIPHeader or X-Forwarded-For is required, as are the headers of the Required fields.
+func (p CDN) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff != "" {
+		if fw.For, err = c.ParseHops(xff); err != nil {
+			return nil, err
+		}
+	}
+	if fw.Client, err = p.client(c, r, fw.For); err != nil {
+		return nil, err
+	}
+	if fw.Client.Kind == HopInvalid && len(fw.For) == 0 {
+		return nil, ErrMustHaveXForwardedFor
+	}
+
+	if p.SecureHeader != "" {
+		secure, err := c.Header(r.Header, p.SecureHeader)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(secure) {
+		case "", "0", "false", "off":
+			fw.Proto = "http"
+		default:
+			fw.Proto = "https"
+		}
+	} else {
+		protoHeader := p.ProtoHeader
+		if protoHeader == "" {
+			protoHeader = "X-Forwarded-Proto"
+		}
+		if fw.Proto, err = p.header(c, r, protoHeader, FieldProto); err != nil {
+			return nil, err
+		}
+	}
+
+	if fw.Host, err = p.header(c, r, p.HostHeader, FieldHost); err != nil {
+		return nil, err
+	}
+	if fw.Port, err = p.header(c, r, p.PortHeader, 0); err != nil {
+		return nil, err
+	}
+	cert, err := p.header(c, r, p.ClientCertHeader, FieldClientCert)
+	if err != nil {
+		return nil, err
+	}
+	if fw.Certificates, err = parseCertificates(cert, p.ClientCertFormat, ErrClientCertHeaderMustBeValid); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrClientCertHeaderMustBeValid, p.ClientCertHeader)
+	}
+
+	if p.CountryHeader != "" {
+		country, err := c.Header(r.Header, p.CountryHeader)
+		if err != nil {
+			return nil, err
+		}
+		fw.setAttribute(AttrCountry, country)
+	}
+	return fw, nil
+}
+
+//header reads the configured header, if any, returning ErrMustHaveRequiredHeader if it is absent and field is Required.
+func (p CDN) header(c *Config, r *http.Request, header string, field Field) (string, error) {
+	var v string
+	if header != "" {
+		var err error
+		if v, err = c.Header(r.Header, header); err != nil {
+			return "", err
+		}
+	}
+	if v == "" && field != 0 && p.Required.Has(field) {
+		if header == "" {
+			header = field.String()
+		}
+		return "", fmt.Errorf("%w: %s", ErrMustHaveRequiredHeader, header)
+	}
+	return v, nil
+}
+
+//client selects the client from ClientIPHeader or, with HopCountHeader, from the hops. It returns an invalid hop if neither
+//are present, so the client is selected with the trusted proxies.
+func (p CDN) client(c *Config, r *http.Request, hops []Hop) (Hop, error) {
+	if p.ClientIPHeader != "" {
+		cip, err := c.Header(r.Header, p.ClientIPHeader)
+		if err != nil {
+			return Hop{}, err
+		}
+		if cip != "" {
+			client, err := ParseHop(cip)
+			if err != nil || client.Kind != HopIP {
+				return Hop{}, fmt.Errorf("%w: %s", ErrClientIPHeaderMustBeValid, p.ClientIPHeader)
+			}
+			return client, nil
+		}
+	}
+	if p.HopCountHeader == "" {
+		return Hop{}, nil
+	}
+	count, err := c.Header(r.Header, p.HopCountHeader)
+	if err != nil || count == "" {
+		return Hop{}, err
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return Hop{}, fmt.Errorf("%w: %s", ErrHopCountHeaderMustBeValid, p.HopCountHeader)
+	}
+	if n > len(hops) {
+		return Hop{}, nil
+	}
+	return hops[len(hops)-n], nil
+}
+
+//Fastly is the Preset for requests proxied by Fastly.
+//
+//The client address comes from Fastly-Client-IP and the protocol from Fastly-SSL, present for TLS connections.
+//See CDN for the details.
+type Fastly struct {
+	//Ranges are the Fastly addresses trusted to send the headers. If nil, FastlyRanges is used.
+	//Use LoadPrefixFiles to load an updated copy of https://api.fastly.com/public-ip-list, one prefix per line.
+	Ranges *PrefixSet
+}
+
+//cdn returns the CDN configuration of Fastly.
+func (p Fastly) cdn() CDN {
+	ranges := p.Ranges
+	if ranges == nil {
+		ranges = fastlyRanges
+	}
+	return CDN{ID: "fastly", ClientIPHeader: "Fastly-Client-IP", SecureHeader: "Fastly-SSL", Ranges: ranges}
+}
+
+//Name returns "fastly".
+func (p Fastly) Name() string {
+	return p.cdn().Name()
+}
+
+//Headers returns the Fastly headers and the X-Forwarded-* ones.
+func (p Fastly) Headers() []string {
+	return p.cdn().Headers()
+}
+
+//TrustedProxies returns the Fastly ranges.
+func (p Fastly) TrustedProxies() *PrefixSet {
+	return p.cdn().TrustedProxies()
+}
+
+//Extract reads the Fastly headers. Fastly-Client-IP or X-Forwarded-For is required.
+func (p Fastly) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	return p.cdn().Extract(c, r)
+}
+
+//Akamai is the Preset for requests proxied by Akamai.
+//
+//The client address comes from True-Client-IP or, if it is not enabled, from X-Forwarded-For, using the number of Akamai
+//servers in Akamai-Origin-Hop. The protocol comes from X-Forwarded-Proto, if enabled. See CDN for the details.
+type Akamai struct {
+	//Ranges are the Akamai addresses trusted to send the headers, like the Site Shield map of the property. As Akamai does
+	//not publish them, if nil only Config.TrustedProxies are trusted. Use LoadPrefixFiles to load them.
+	Ranges *PrefixSet
+}
+
+//cdn returns the CDN configuration of Akamai.
+func (p Akamai) cdn() CDN {
+	return CDN{ID: "akamai", ClientIPHeader: "True-Client-IP", HopCountHeader: "Akamai-Origin-Hop", Ranges: p.Ranges}
+}
+
+//Name returns "akamai".
+func (p Akamai) Name() string {
+	return p.cdn().Name()
+}
+
+//Headers returns the Akamai headers and the X-Forwarded-* ones.
+func (p Akamai) Headers() []string {
+	return p.cdn().Headers()
+}
+
+//TrustedProxies returns the Akamai ranges.
+func (p Akamai) TrustedProxies() *PrefixSet {
+	return p.cdn().TrustedProxies()
+}
+
+//Extract reads the Akamai headers. True-Client-IP or X-Forwarded-For is required.
+func (p Akamai) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	return p.cdn().Extract(c, r)
+}
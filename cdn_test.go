@@ -0,0 +1,237 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestFastly(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.Fastly{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "151.101.1.1:40000"
+	req.Header.Add("Fastly-Client-IP", "203.0.113.7")
+	req.Header.Add("Fastly-SSL", "1")
+	req.Header.Add("X-Forwarded-For", "192.0.2.1, 203.0.113.7")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.7", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "https", pr.URL.Scheme; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "fastly", proxyheaders.PresetName(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "", pr.Header.Get("Fastly-Client-IP"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//Without Fastly-SSL it is plain http.
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "151.101.1.1:40000"
+	req.Header.Add("Fastly-Client-IP", "203.0.113.7")
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "http", pr.URL.Scheme; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "151.101.1.1:40000"
+	req.Header.Add("Fastly-Client-IP", "client")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := true, errors.Is(err, proxyheaders.ErrClientIPHeaderMustBeValid); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "151.101.1.1:40000"
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrMustHaveXForwardedFor, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	//Requests not coming from Fastly.
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "198.51.100.1:40000"
+	req.Header.Add("Fastly-Client-IP", "203.0.113.7")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrProxyMustBeTrusted, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestAkamai(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "akamai.txt")
+	if err := os.WriteFile(path, []byte("#Site Shield map\n23.32.0.0/11\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ranges, err := proxyheaders.LoadPrefixFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &proxyheaders.Config{Preset: proxyheaders.Akamai{Ranges: ranges}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "23.32.1.1:40000"
+	req.Header.Add("True-Client-IP", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.7", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "https", pr.URL.Scheme; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//Without True-Client-IP, the origin hops are counted from the right.
+	tests := []struct {
+		hops string
+		want string
+	}{
+		{"1", "23.32.9.9"},
+		{"2", "203.0.113.7"},
+		//Not enough hops, selected with the trusted proxies.
+		{"5", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+		req.RemoteAddr = "23.32.1.1:40000"
+		req.Header.Add("X-Forwarded-For", "192.0.2.1, 203.0.113.7, 23.32.9.9")
+		req.Header.Add("Akamai-Origin-Hop", tt.hops)
+		pr, err = c.NewProxiedRequest(req)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("hops=%s: want=%v, got=%v", tt.hops, want, got)
+		}
+		if want, got := tt.want, pr.RemoteAddr; want != got {
+			t.Fatalf("hops=%s: want=%s, got=%s", tt.hops, want, got)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "23.32.1.1:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("Akamai-Origin-Hop", "0")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := true, errors.Is(err, proxyheaders.ErrHopCountHeaderMustBeValid); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+}
+
+func TestCDN(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.CDN{
+		ID:             "example-cdn",
+		ClientIPHeader: "X-Client-IP",
+		ProtoHeader:    "X-Client-Scheme",
+		CountryHeader:  "X-Client-Country",
+		Ranges:         proxyheaders.NewPrefixSet(netip.MustParsePrefix("192.0.2.0/24")),
+	}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "192.0.2.10:40000"
+	req.Header.Add("X-Client-IP", "2001:db8::1")
+	req.Header.Add("X-Client-Scheme", "https")
+	req.Header.Add("X-Client-Country", "BR")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "2001:db8::1", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "https", pr.URL.Scheme; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "BR", proxyheaders.Attribute(pr, proxyheaders.AttrCountry); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "example-cdn", proxyheaders.PresetName(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "", pr.Header.Get("X-Client-Country"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+}
+
+func TestCDN_headers(t *testing.T) {
+	ca, caKey := newCert(t, "Root CA", true, nil, nil)
+	client, _ := newCert(t, "John Doe", false, ca, caKey)
+	c := &proxyheaders.Config{Preset: proxyheaders.CDN{
+		ID:               "example-cdn",
+		ClientIPHeader:   "X-Client-IP",
+		HostHeader:       "X-Client-Host",
+		PortHeader:       "X-Client-Port",
+		ClientCertHeader: "X-Client-Cert",
+		ClientCertFormat: proxyheaders.CertFormatBase64DER,
+		Required:         proxyheaders.FieldProto | proxyheaders.FieldClientCert,
+	}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://origin.example.com/", nil)
+	req.Header.Add("X-Client-IP", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Client-Host", "www.example.com")
+	req.Header.Add("X-Client-Port", "8443")
+	req.Header.Add("X-Client-Cert", base64.StdEncoding.EncodeToString(client.Raw))
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "www.example.com:8443", pr.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "John Doe", pr.TLS.PeerCertificates[0].Subject.CommonName; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req.Header.Set("X-Client-Cert", pemEncode(client))
+	_, err = c.NewProxiedRequest(req)
+	if want, got := true, errors.Is(err, proxyheaders.ErrClientCertHeaderMustBeValid); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	//The fields required must be in the headers.
+	for _, h := range []string{"X-Forwarded-Proto", "X-Client-Cert"} {
+		req := httptest.NewRequest(http.MethodGet, "http://origin.example.com/", nil)
+		req.Header.Add("X-Client-IP", "203.0.113.7")
+		req.Header.Add("X-Forwarded-Proto", "https")
+		req.Header.Add("X-Client-Cert", base64.StdEncoding.EncodeToString(client.Raw))
+		req.Header.Del(h)
+		_, err = c.NewProxiedRequest(req)
+		if want, got := true, errors.Is(err, proxyheaders.ErrMustHaveRequiredHeader); want != got {
+			t.Fatalf("%s: want=%t, got=%t", h, want, got)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"bytes"
+	_ "embed" //Needed for go:embed.
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+//Errors returned by the Cloudflare preset.
+var (
+	//ErrMustHaveCFConnectingIP is returned when the CF-Connecting-IP header is not present.
+	ErrMustHaveCFConnectingIP = errors.New("proxyheaders: must have CF-Connecting-IP in headers")
+	//ErrCFConnectingIPMustBeValid is returned when the CF-Connecting-IP header is not an IP address.
+	ErrCFConnectingIPMustBeValid = errors.New("proxyheaders: CF-Connecting-IP must be an IP address")
+	//ErrMustHaveCFVisitor is returned when neither the CF-Visitor nor the X-Forwarded-Proto header are present.
+	ErrMustHaveCFVisitor = errors.New("proxyheaders: must have CF-Visitor in headers")
+	//ErrCFVisitorMustBeValid is returned when the CF-Visitor header is not a JSON object with a scheme.
+	ErrCFVisitorMustBeValid = errors.New(`proxyheaders: CF-Visitor must be like {"scheme":"https"}`)
+)
+
+//The IP ranges published by Cloudflare in https://www.cloudflare.com/ips-v4 and https://www.cloudflare.com/ips-v6.
+var (
+	//go:embed ranges/cloudflare-ips-v4.txt
+	cloudflareIPv4 []byte
+	//go:embed ranges/cloudflare-ips-v6.txt
+	cloudflareIPv6 []byte
+
+	cloudflareRanges = mustReadPrefixList(cloudflareIPv4, cloudflareIPv6)
+)
+
+//mustReadPrefixList reads embedded prefix lists, panicking on errors.
+func mustReadPrefixList(lists ...[]byte) *PrefixSet {
+	set, err := ReadPrefixList(bytes.NewReader(bytes.Join(lists, []byte("\n"))))
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+//CloudflareRanges returns the Cloudflare IP ranges embedded in this package. The returned set is shared and must not be modified.
+func CloudflareRanges() *PrefixSet {
+	return cloudflareRanges
+}
+
+//Cloudflare is the Preset for requests proxied by Cloudflare.
+//
+//The client address comes from CF-Connecting-IP and the protocol from the CF-Visitor JSON ({"scheme":"https"}), falling back
+//to X-Forwarded-Proto. The host is the Host header, the proxied hostname unless an Origin Rule rewrites it. X-Forwarded-For,
+//if present, is kept as the hops (see ForwardedFor). The country (CF-IPCountry) and the ray ID (CF-Ray) are available with
+//Attribute, as AttrCountry and AttrRayID.
+type Cloudflare struct {
+	//Ranges are the Cloudflare addresses trusted to send the headers. If nil, CloudflareRanges is used.
+	//Use LoadPrefixFiles to load an updated copy of https://www.cloudflare.com/ips-v4 and https://www.cloudflare.com/ips-v6.
+	Ranges *PrefixSet
+}
+
+//Name returns "cloudflare".
+func (Cloudflare) Name() string {
+	return "cloudflare"
+}
+
+//Headers returns the Cloudflare headers and the X-Forwarded-* ones.
+func (Cloudflare) Headers() []string {
+	return append([]string{"CF-Connecting-IP", "CF-Connecting-IPv6", "CF-Visitor", "CF-IPCountry", "CF-Ray"}, forwardingHeaders...)
+}
+
+//TrustedProxies returns the Cloudflare ranges.
+func (p Cloudflare) TrustedProxies() *PrefixSet {
+	if p.Ranges == nil {
+		return cloudflareRanges
+	}
+	return p.Ranges
+}
+
+//Extract reads the Cloudflare headers. CF-Connecting-IP and CF-Visitor (or X-Forwarded-Proto) are required.
+func (Cloudflare) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+
+	cip, err := c.Header(r.Header, "CF-Connecting-IP")
+	if err != nil {
+		return nil, err
+	}
+	if cip == "" {
+		return nil, ErrMustHaveCFConnectingIP
+	}
+	if fw.Client, err = ParseHop(cip); err != nil || fw.Client.Kind != HopIP {
+		return nil, ErrCFConnectingIPMustBeValid
+	}
+
+	visitor, err := c.Header(r.Header, "CF-Visitor")
+	if err != nil {
+		return nil, err
+	}
+	if visitor != "" {
+		var v struct {
+			Scheme string `json:"scheme"`
+		}
+		if err := json.Unmarshal([]byte(visitor), &v); err != nil || v.Scheme == "" {
+			return nil, ErrCFVisitorMustBeValid
+		}
+		fw.Proto = v.Scheme
+	} else if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Proto == "" {
+		return nil, ErrMustHaveCFVisitor
+	}
+
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff != "" {
+		if fw.For, err = c.ParseHops(xff); err != nil {
+			return nil, err
+		}
+	}
+
+	country, err := c.Header(r.Header, "CF-IPCountry")
+	if err != nil {
+		return nil, err
+	}
+	fw.setAttribute(AttrCountry, country)
+	ray, err := c.Header(r.Header, "CF-Ray")
+	if err != nil {
+		return nil, err
+	}
+	fw.setAttribute(AttrRayID, ray)
+	return fw, nil
+}
@@ -0,0 +1,164 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestCloudflare(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.Cloudflare{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "172.70.1.1:443"
+	req.Header.Add("CF-Connecting-IP", "2001:db8::1")
+	req.Header.Add("CF-Visitor", `{"scheme":"https"}`)
+	req.Header.Add("CF-IPCountry", "BR")
+	req.Header.Add("CF-Ray", "230b030023ae2822-SJC")
+	req.Header.Add("X-Forwarded-For", "2001:db8::1")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "2001:db8::1", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "www.example.com", pr.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "https", pr.URL.Scheme; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := true, proxyheaders.TLSProxyAsserted(pr); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "BR", proxyheaders.Attribute(pr, proxyheaders.AttrCountry); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "230b030023ae2822-SJC", proxyheaders.Attribute(pr, proxyheaders.AttrRayID); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "cloudflare", proxyheaders.PresetName(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := proxyheaders.FieldClientIP|proxyheaders.FieldProto, proxyheaders.AssertedFields(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "", pr.Header.Get("CF-Connecting-IP"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//Requests not coming from Cloudflare.
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "1.2.3.4:443"
+	req.Header.Add("CF-Connecting-IP", "2001:db8::1")
+	req.Header.Add("CF-Visitor", `{"scheme":"https"}`)
+	req.Header.Add("CF-IPCountry", "BR")
+	req.Header.Add("CF-Ray", "230b030023ae2822-SJC")
+	req.Header.Add("X-Forwarded-For", "2001:db8::1")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrProxyMustBeTrusted, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestCloudflare_fail(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.Cloudflare{}}
+	tests := []struct {
+		header, value string
+		err           error
+	}{
+		{"CF-Connecting-IP", "", proxyheaders.ErrMustHaveCFConnectingIP},
+		{"CF-Connecting-IP", "unknown", proxyheaders.ErrCFConnectingIPMustBeValid},
+		{"CF-Visitor", `{"scheme":`, proxyheaders.ErrCFVisitorMustBeValid},
+		{"CF-Visitor", `{}`, proxyheaders.ErrCFVisitorMustBeValid},
+		{"CF-Visitor", `{"scheme":"gopher"}`, proxyheaders.ErrXForwardedProtoMustBeValid},
+		{"CF-Visitor", "", proxyheaders.ErrMustHaveCFVisitor},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+		req.RemoteAddr = "104.16.0.1:443"
+		req.Header.Add("CF-Connecting-IP", "2001:db8::1")
+		req.Header.Add("CF-Visitor", `{"scheme":"https"}`)
+		req.Header.Add("CF-IPCountry", "BR")
+		req.Header.Add("CF-Ray", "230b030023ae2822-SJC")
+		req.Header.Add("X-Forwarded-For", "2001:db8::1")
+		if tt.value == "" {
+			req.Header.Del(tt.header)
+		} else {
+			req.Header.Set(tt.header, tt.value)
+		}
+		_, err := c.NewProxiedRequest(req)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("%s=%q: want=%v, got=%v", tt.header, tt.value, tt.err, err)
+		}
+	}
+}
+
+func TestCloudflare_ranges(t *testing.T) {
+	for _, a := range []string{"173.245.48.1", "104.16.0.1", "2606:4700::1", "2a06:98c0::1"} {
+		if want, got := true, proxyheaders.CloudflareRanges().Contains(netip.MustParseAddr(a)); want != got {
+			t.Fatalf("%s: want=%t, got=%t", a, want, got)
+		}
+	}
+
+	dir := t.TempDir()
+	v4 := filepath.Join(dir, "ips-v4")
+	if err := os.WriteFile(v4, []byte("# updated\n198.51.100.0/24\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ranges, err := proxyheaders.LoadPrefixFiles(v4)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	c := &proxyheaders.Config{Preset: proxyheaders.Cloudflare{Ranges: ranges}}
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "198.51.100.7:443"
+	req.Header.Add("CF-Connecting-IP", "2001:db8::1")
+	req.Header.Add("CF-Visitor", `{"scheme":"https"}`)
+	req.Header.Add("CF-IPCountry", "BR")
+	req.Header.Add("CF-Ray", "230b030023ae2822-SJC")
+	req.Header.Add("X-Forwarded-For", "2001:db8::1")
+	if _, err := c.NewProxiedRequest(req); err != nil {
+		t.Fatalf("want=nil, got=%v", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "104.16.0.1:443"
+	req.Header.Add("CF-Connecting-IP", "2001:db8::1")
+	req.Header.Add("CF-Visitor", `{"scheme":"https"}`)
+	req.Header.Add("CF-IPCountry", "BR")
+	req.Header.Add("CF-Ray", "230b030023ae2822-SJC")
+	req.Header.Add("X-Forwarded-For", "2001:db8::1")
+	if _, err := c.NewProxiedRequest(req); err != proxyheaders.ErrProxyMustBeTrusted {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrProxyMustBeTrusted, err)
+	}
+
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("198.51.100.0/24\nnot-a-cidr\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proxyheaders.LoadPrefixFiles(bad); err == nil {
+		t.Fatalf("want!=nil, got=nil")
+	}
+}
@@ -0,0 +1,126 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+//Config customizes how the forwarding headers are processed by Config.NewProxiedRequest.
+//
+//The zero value is ready to use, and it is the configuration used by the package level NewProxiedRequest.
+type Config struct {
+	//DuplicateHeaders is the policy applied to every consumed header that is repeated in more than one line.
+	//Defaults to DuplicateCombine.
+	DuplicateHeaders DuplicatePolicy
+	//InvalidHops is the policy applied to X-Forwarded-For entries that cannot be parsed. Defaults to InvalidHopReject.
+	InvalidHops InvalidHopPolicy
+
+	//TrustedProxies are the addresses of the proxies allowed to send forwarding headers. When set, the request peer
+	//(http.Request.RemoteAddr) must be one of them, otherwise ErrProxyMustBeTrusted is returned, and the client is the
+	//rightmost X-Forwarded-For entry that is not a trusted proxy. The Preset proxies, if any, are trusted too.
+	//If none is set, any peer is accepted and the client is the leftmost X-Forwarded-For entry.
+	TrustedProxies *PrefixSet
+	//AllowedHosts restricts the hosts accepted, forwarded or, if the proxy does not forward it, the request Host (compared
+	//case-insensitively and without port).
+	//An entry like "*.example.com" matches any subdomain of example.com. If empty, any host is accepted.
+	AllowedHosts []string
+	//ClientCAs, if not nil, are the roots used to verify the forwarded client certificates, filling http.Request.TLS.VerifiedChains.
+	//The certificates after the first one are used as intermediates. An identity the proxy asserts without forwarding the
+	//certificate (like the HAProxy distinguished names) cannot be verified, and fails with ErrXForwardedClientCertMustBeVerified.
+	ClientCAs *x509.CertPool
+	//ClientCRLs are the revocation lists checked against the chains verified by ClientCAs. A certificate listed in a CRL
+	//signed by its issuer fails with ErrXForwardedClientCertMustNotBeRevoked. A CRL past its NextUpdate is stale, and the
+	//certificates of its issuer fail with ErrXForwardedClientCertMustBeVerified until it is replaced. They have no effect
+	//without ClientCAs.
+	ClientCRLs []*x509.RevocationList
+	//RequireClientCert makes the X-Forwarded-Client-Cert header (or the client certificate headers of the Preset) mandatory,
+	//returning ErrMustHaveXForwardedClientCert if absent. Together with ClientCAs it requires a client certificate verified by them.
+	RequireClientCert bool
+	//ReportOnly makes the policy checks (TrustedProxies, AllowedHosts, ClientCAs and RequireClientCert) not fail the request. Their violations
+	//are recorded in the returned request instead, and retrievable with Violations.
+	ReportOnly bool
+
+	//Preset extracts the forwarded values from the headers of a specific proxy. If nil, XForwarded is used.
+	Preset Preset
+}
+
+//preset returns the configured preset or the default one.
+func (c *Config) preset() Preset {
+	if c.Preset == nil {
+		return XForwarded{}
+	}
+	return c.Preset
+}
+
+//violation returns err, or records it in f returning nil if the configuration is report only.
+func (c *Config) violation(f *forwarded, err error) error {
+	if !c.ReportOnly {
+		return err
+	}
+	f.violations = append(f.violations, err)
+	return nil
+}
+
+//Validate checks the configuration before it is used, returning an error wrapping ErrConfigMustBeValid with the first
+//problem found. A nil c is valid.
+//
+//The configuration is checked as a whole, so it is meant to be called before replacing a configuration in use (eg: in a reload).
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.DuplicateHeaders < DuplicateCombine || c.DuplicateHeaders > DuplicateReject {
+		return fmt.Errorf("%w: unknown duplicate headers policy %v", ErrConfigMustBeValid, c.DuplicateHeaders)
+	}
+	if c.InvalidHops < InvalidHopReject || c.InvalidHops > InvalidHopSkip {
+		return fmt.Errorf("%w: unknown invalid hops policy %v", ErrConfigMustBeValid, c.InvalidHops)
+	}
+	for _, host := range c.AllowedHosts {
+		if !validAllowedHost(host) {
+			return fmt.Errorf("%w: allowed host %q", ErrConfigMustBeValid, host)
+		}
+	}
+	for i, crl := range c.ClientCRLs {
+		if crl == nil {
+			return fmt.Errorf("%w: client CRL %d is nil", ErrConfigMustBeValid, i)
+		}
+	}
+	if len(c.ClientCRLs) > 0 && c.ClientCAs == nil {
+		return fmt.Errorf("%w: client CRLs require client CAs", ErrConfigMustBeValid)
+	}
+	//The Front Door addresses are shared by all the tenants: without its ID any of them is trusted.
+	azure, ok := c.Preset.(Azure)
+	if pa, isPtr := c.Preset.(*Azure); isPtr && pa != nil {
+		azure, ok = *pa, true
+	}
+	if ok && azure.FrontDoorID == "" && azure.Ranges == nil && c.TrustedProxies == nil {
+		return fmt.Errorf("%w: the azure preset requires a FrontDoorID, or the trusted proxies", ErrConfigMustBeValid)
+	}
+	return nil
+}
+
+//validAllowedHost reports if host is a host name or address, without port, optionally starting with the "*." wildcard.
+func validAllowedHost(host string) bool {
+	name := strings.TrimPrefix(host, "*.")
+	if name == "" || strings.Contains(name, "*") {
+		return false
+	}
+	//IPv6 addresses are written without brackets, as they are compared without port.
+	return !strings.ContainsAny(name, "/?#@ \t[]") && (strings.Count(name, ":") == 0 || strings.Count(name, ":") > 1)
+}
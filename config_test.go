@@ -0,0 +1,60 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	for _, c := range []*proxyheaders.Config{
+		nil,
+		{},
+		{AllowedHosts: []string{"www.example.com", "*.example.org", "10.0.0.1", "2001:db8::1", "example.net."}},
+		{ClientCAs: x509.NewCertPool(), ClientCRLs: []*x509.RevocationList{{}}},
+		{Preset: proxyheaders.Azure{FrontDoorID: "a0b1c2d3-e4f5-6789-abcd-ef0123456789"}},
+		{Preset: &proxyheaders.Azure{FrontDoorID: "a0b1c2d3-e4f5-6789-abcd-ef0123456789"}},
+		//An Application Gateway, that sends no X-Azure-FDID.
+		{Preset: proxyheaders.Azure{Ranges: proxyheaders.NewPrefixSet(netip.MustParsePrefix("10.1.0.0/24"))}},
+	} {
+		if err := c.Validate(); err != nil {
+			t.Fatalf("%+v: want=nil, got=%v", c, err)
+		}
+	}
+	for _, c := range []*proxyheaders.Config{
+		{DuplicateHeaders: proxyheaders.DuplicateReject + 1},
+		{InvalidHops: -1},
+		{AllowedHosts: []string{""}},
+		{AllowedHosts: []string{"*"}},
+		{AllowedHosts: []string{"www.*.example.com"}},
+		{AllowedHosts: []string{"www.example.com:443"}},
+		{AllowedHosts: []string{"https://www.example.com"}},
+		{AllowedHosts: []string{"[2001:db8::1]"}},
+		{ClientCAs: x509.NewCertPool(), ClientCRLs: []*x509.RevocationList{nil}},
+		{ClientCRLs: []*x509.RevocationList{{}}},
+		{Preset: proxyheaders.Azure{}},
+		{Preset: &proxyheaders.Azure{}},
+	} {
+		if err := c.Validate(); !errors.Is(err, proxyheaders.ErrConfigMustBeValid) {
+			t.Fatalf("%+v: want=%v, got=%v", c, proxyheaders.ErrConfigMustBeValid, err)
+		}
+	}
+}
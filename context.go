@@ -0,0 +1,115 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import "net/http"
+
+//Some Constants used in namespaces.
+const (
+	ctxForwardedValue = "gitlab.com/gopherburrow/proxyheaders Forwarded"
+)
+
+//Used in request contexts. Go suggests using a specific type different from string for context keys.
+type ctxType string
+
+//The key used to store the forwarded values that have no place in http.Request fields.
+var ctxForwarded = ctxType(ctxForwardedValue)
+
+//forwarded holds the values resolved by NewProxiedRequest that cannot be represented in the http.Request itself.
+type forwarded struct {
+	//prefix is the path prefix stripped by the proxy, from X-Forwarded-Prefix. Empty if none.
+	prefix string
+	//hops is the parsed X-Forwarded-For, from the client to the nearest proxy.
+	hops []Hop
+	//tlsAsserted is true when http.Request.TLS was synthesized from proxy headers.
+	tlsAsserted bool
+	//violations are the policy violations recorded in report only mode.
+	violations []error
+	//asserted are the fields whose values came from the proxy headers.
+	asserted Field
+	//attributes are the values specific to the proxy, see Forwarded.Attributes.
+	attributes map[string]string
+	//preset is the name of the preset used.
+	preset string
+	//identity is the client certificate identity, nil if there is none.
+	identity *ClientIdentity
+}
+
+//forwardedFrom retrieves the forwarded values of a request returned by NewProxiedRequest, or nil if r was not processed by it.
+func forwardedFrom(r *http.Request) *forwarded {
+	f, _ := r.Context().Value(ctxForwarded).(*forwarded)
+	return f
+}
+
+//TLSProxyAsserted reports whether r.TLS was synthesized by NewProxiedRequest from what the proxy asserted in the headers, instead of
+//observed in a TLS handshake with this server.
+//
+//Security sensitive code must keep in mind that in this case the version, cipher suite and even the client certificates are only as
+//trustworthy as the proxy that sent them.
+func TLSProxyAsserted(r *http.Request) bool {
+	f := forwardedFrom(r)
+	return f != nil && f.tlsAsserted && r.TLS != nil
+}
+
+//ForwardedFor returns the parsed X-Forwarded-For entries of a request returned by NewProxiedRequest, from the client (first) to
+//the nearest proxy (last). If r was not processed by NewProxiedRequest it returns nil.
+func ForwardedFor(r *http.Request) []Hop {
+	f := forwardedFrom(r)
+	if f == nil {
+		return nil
+	}
+	return append([]Hop(nil), f.hops...)
+}
+
+//Violations returns the policy violations recorded by Config.NewProxiedRequest in report only mode (see Config.ReportOnly).
+//If there is none, or r was not processed by NewProxiedRequest, it returns nil.
+func Violations(r *http.Request) []error {
+	f := forwardedFrom(r)
+	if f == nil {
+		return nil
+	}
+	return append([]error(nil), f.violations...)
+}
+
+//AssertedFields returns which fields of a request returned by NewProxiedRequest had their values asserted by the proxy, instead of
+//observed by this server. If r was not processed by NewProxiedRequest it returns 0.
+func AssertedFields(r *http.Request) Field {
+	f := forwardedFrom(r)
+	if f == nil {
+		return 0
+	}
+	return f.asserted
+}
+
+//Attribute returns a value specific to the proxy (like the client country) of a request returned by NewProxiedRequest.
+//See the Attr* constants for the well-known names. It returns an empty string if the attribute is absent.
+func Attribute(r *http.Request, name string) string {
+	f := forwardedFrom(r)
+	if f == nil {
+		return ""
+	}
+	return f.attributes[name]
+}
+
+//PresetName returns the name of the Preset that resolved a request returned by NewProxiedRequest, or an empty string if r
+//was not processed by NewProxiedRequest.
+func PresetName(r *http.Request) string {
+	f := forwardedFrom(r)
+	if f == nil {
+		return ""
+	}
+	return f.preset
+}
@@ -0,0 +1,211 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//ErrDistinguishedNameMustBeValid is returned when a distinguished name is not in the OpenSSL slash or the RFC 4514 format.
+//The actual error returned wraps this one, with the offending name.
+var ErrDistinguishedNameMustBeValid = errors.New("proxyheaders: distinguished name must be in the OpenSSL slash or RFC 4514 format")
+
+//dnAttributes are the object identifiers of the attribute type names, in uppercase, of RFC 4514 and OpenSSL.
+var dnAttributes = map[string]asn1.ObjectIdentifier{
+	"CN":           {2, 5, 4, 3},
+	"SN":           {2, 5, 4, 4},
+	"SERIALNUMBER": {2, 5, 4, 5},
+	"C":            {2, 5, 4, 6},
+	"L":            {2, 5, 4, 7},
+	"ST":           {2, 5, 4, 8},
+	"S":            {2, 5, 4, 8},
+	"STREET":       {2, 5, 4, 9},
+	"O":            {2, 5, 4, 10},
+	"OU":           {2, 5, 4, 11},
+	"TITLE":        {2, 5, 4, 12},
+	"POSTALCODE":   {2, 5, 4, 17},
+	"GN":           {2, 5, 4, 42},
+	"DC":           {0, 9, 2342, 19200300, 100, 1, 25},
+	"UID":          {0, 9, 2342, 19200300, 100, 1, 1},
+	"EMAILADDRESS": {1, 2, 840, 113549, 1, 9, 1},
+}
+
+//ParseDistinguishedName parses a distinguished name in the OpenSSL slash format ("/C=US/O=Example/CN=client", the most
+//general attribute first) or in the RFC 4514 format ("CN=client,O=Example,C=US", the most specific attribute first).
+//
+//Attribute types are the usual names (CN, O, OU, C, ST, L, DC, UID, emailAddress...), case-insensitive, or dotted object
+//identifiers. The multi-valued RDNs ("+"), escapes and hexadecimal ("#") values of RFC 4514 are supported.
+func ParseDistinguishedName(s string) (pkix.Name, error) {
+	var seq pkix.RDNSequence
+	var err error
+	if strings.HasPrefix(s, "/") {
+		seq, err = parseSlashDN(s[1:])
+	} else {
+		seq, err = parseRFC4514DN(s)
+	}
+	if err != nil || len(seq) == 0 {
+		return pkix.Name{}, fmt.Errorf("%w: %q", ErrDistinguishedNameMustBeValid, s)
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&seq)
+	return name, nil
+}
+
+//parseSlashDN parses the OpenSSL slash format, without the leading slash. OpenSSL does not escape slashes in values, so
+//a segment that does not start with an attribute type and "=" is part of the previous value.
+func parseSlashDN(s string) (pkix.RDNSequence, error) {
+	var seq pkix.RDNSequence
+	for _, segment := range strings.Split(s, "/") {
+		typ, value, ok := strings.Cut(segment, "=")
+		if !ok || !isDNAttributeType(typ) {
+			if len(seq) == 0 {
+				return nil, ErrDistinguishedNameMustBeValid
+			}
+			last := &seq[len(seq)-1][0]
+			last.Value = last.Value.(string) + "/" + segment
+			continue
+		}
+		oid, err := dnAttributeType(typ)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, pkix.RelativeDistinguishedNameSET{{Type: oid, Value: value}})
+	}
+	return seq, nil
+}
+
+//isDNAttributeType reports if typ has the syntax of an attribute type name or dotted object identifier.
+func isDNAttributeType(typ string) bool {
+	if typ == "" {
+		return false
+	}
+	for _, c := range typ {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+//parseRFC4514DN parses the RFC 4514 format, returning the RDNs in the certificate order (the most general first).
+func parseRFC4514DN(s string) (pkix.RDNSequence, error) {
+	var seq pkix.RDNSequence
+	var rdn pkix.RelativeDistinguishedNameSET
+	for {
+		//Read the type...
+		typ, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, ErrDistinguishedNameMustBeValid
+		}
+		oid, err := dnAttributeType(strings.TrimSpace(typ))
+		if err != nil {
+			return nil, err
+		}
+		//...and the value, up to an unescaped separator.
+		value, sep, rest, err := readRFC4514Value(strings.TrimLeft(rest, " "))
+		if err != nil {
+			return nil, err
+		}
+		rdn = append(rdn, pkix.AttributeTypeAndValue{Type: oid, Value: value})
+		if sep == '+' {
+			s = rest
+			continue
+		}
+		seq = append(pkix.RDNSequence{rdn}, seq...)
+		rdn = nil
+		if sep == 0 {
+			return seq, nil
+		}
+		s = rest
+	}
+}
+
+//readRFC4514Value reads a value up to an unescaped ",", ";" or "+", returning the separator (0 at the end) and the remainder.
+func readRFC4514Value(s string) (value interface{}, sep byte, rest string, err error) {
+	if strings.HasPrefix(s, "#") {
+		end := strings.IndexAny(s, ",;+")
+		if end == -1 {
+			end = len(s)
+		}
+		der, err := hex.DecodeString(strings.TrimSpace(s[1:end]))
+		if err != nil {
+			return nil, 0, "", ErrDistinguishedNameMustBeValid
+		}
+		var v interface{}
+		if rest, err := asn1.Unmarshal(der, &v); err != nil || len(rest) > 0 {
+			return nil, 0, "", ErrDistinguishedNameMustBeValid
+		}
+		if end < len(s) {
+			return v, s[end], s[end+1:], nil
+		}
+		return v, 0, "", nil
+	}
+	var b strings.Builder
+	//trailing counts the unescaped trailing spaces, that are not part of the value.
+	trailing := 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\':
+			if i+1 >= len(s) {
+				return nil, 0, "", ErrDistinguishedNameMustBeValid
+			}
+			if n, err := strconv.ParseUint(s[i+1:min(i+3, len(s))], 16, 8); err == nil && i+2 < len(s) {
+				b.WriteByte(byte(n))
+				i += 2
+			} else {
+				b.WriteByte(s[i+1])
+				i++
+			}
+			trailing = 0
+		case ch == ',' || ch == ';' || ch == '+':
+			return b.String()[:b.Len()-trailing], ch, s[i+1:], nil
+		default:
+			b.WriteByte(ch)
+			if ch == ' ' {
+				trailing++
+			} else {
+				trailing = 0
+			}
+		}
+	}
+	return b.String()[:b.Len()-trailing], 0, "", nil
+}
+
+//dnAttributeType returns the object identifier of an attribute type name or dotted object identifier.
+func dnAttributeType(typ string) (asn1.ObjectIdentifier, error) {
+	if oid, ok := dnAttributes[strings.ToUpper(typ)]; ok {
+		return oid, nil
+	}
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(typ), "OID."), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, ErrDistinguishedNameMustBeValid
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, ErrDistinguishedNameMustBeValid
+	}
+	return oid, nil
+}
@@ -0,0 +1,68 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestParseDistinguishedName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/C=US/ST=California/O=Example/CN=client", "CN=client,O=Example,ST=California,C=US"},
+		{"/C=US/O=Example/OU=a/b/CN=client", "CN=client,OU=a/b,O=Example,C=US"},
+		{"/DC=com/DC=example/emailAddress=a@example.com/CN=client", "CN=client,1.2.840.113549.1.9.1=a@example.com,0.9.2342.19200300.100.1.25=example,0.9.2342.19200300.100.1.25=com"},
+		{"CN=client,O=Example,C=US", "CN=client,O=Example,C=US"},
+		{"cn=client; o=Example", "CN=client,O=Example"},
+		{`CN=Example\, Inc.,O=a\2Bb`, `CN=Example\, Inc.,O=a\+b`},
+		{"CN=client+UID=42,O=Example", "CN=client,O=Example,0.9.2342.19200300.100.1.1=42"},
+		{"CN=#0c06636c69656e74", "CN=client"},
+		{"2.5.4.3=client", "CN=client"},
+	}
+	for _, tt := range tests {
+		name, err := proxyheaders.ParseDistinguishedName(tt.in)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("in=%s: want=%v, got=%v", tt.in, want, got)
+		}
+		if want, got := tt.want, name.String(); want != got {
+			t.Fatalf("in=%s: want=%s, got=%s", tt.in, want, got)
+		}
+	}
+
+	name, err := proxyheaders.ParseDistinguishedName("/C=US/O=Example/CN=client")
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "client", name.CommonName; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := []string{"Example"}, name.Organization; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	for _, in := range []string{"", "/", "client", "/client", "CN", "XX=client", "CN=#zz", `CN=client\`, "/XX=client"} {
+		_, err := proxyheaders.ParseDistinguishedName(in)
+		if want, got := true, errors.Is(err, proxyheaders.ErrDistinguishedNameMustBeValid); want != got {
+			t.Fatalf("in=%s: want=%t, got=%t", in, want, got)
+		}
+	}
+}
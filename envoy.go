@@ -0,0 +1,226 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+//Errors returned by the Envoy preset.
+var (
+	//ErrEnvoyExternalAddressMustBeValid is returned when the x-envoy-external-address header is not an IP address.
+	ErrEnvoyExternalAddressMustBeValid = errors.New("proxyheaders: x-envoy-external-address must be an IP address")
+	//ErrEnvoyClientCertMustBeValid is returned when the X-Forwarded-Client-Cert header is not in the Envoy format, like
+	//By=spiffe://cluster.local/ns/default/sa/server;Hash=1a2b...;URI=spiffe://cluster.local/ns/default/sa/client.
+	ErrEnvoyClientCertMustBeValid = errors.New("proxyheaders: X-Forwarded-Client-Cert must be in the Envoy format")
+)
+
+//AttrRequestID is the request identifier generated by the proxy, like the Envoy x-request-id.
+const AttrRequestID = "request-id"
+
+//Envoy is the Preset for requests proxied by Envoy, including Istio sidecars and gateways.
+//
+//The client address comes from x-envoy-external-address, set by the edge Envoy for external requests. If absent, it is
+//selected from X-Forwarded-For like Envoy does with xff_num_trusted_hops: skipping NumTrustedHops addresses from the right,
+//or the rightmost one, as with NumTrustedHops 0, if there are not enough of them. The peer (the sidecar) is never the client.
+//The protocol comes from X-Forwarded-Proto and the optional port from X-Forwarded-Port. Envoy forwards the :authority it routed on as the Host header, so the request Host is used. The
+//request ID (x-request-id), generated by Envoy when absent, is available with Attribute, as AttrRequestID, and left in the
+//request, as the mesh expects the services to propagate it to their upstream calls.
+//
+//The X-Forwarded-Client-Cert is read in the Envoy format. The last element, added by the nearest Envoy, is the peer workload:
+//its Cert (or Chain) is in http.Request.TLS, and its Subject, URI, DNS, Hash and By fields are available with Identity, the
+//SPIFFE ID with ClientIdentity.SPIFFEID. As Envoy only forwards the certificates of mutual TLS connections it validated, the
+//identity is marked as verified.
+type Envoy struct {
+	//NumTrustedHops is the xff_num_trusted_hops of the edge Envoy: the number of trusted proxies in front of it.
+	NumTrustedHops int
+	//Ranges are the Envoy addresses trusted to send the headers, like 127.0.0.6/32 for Istio sidecars. Without them (and
+	//without Config.TrustedProxies) every peer is trusted: any workload reaching the application around its sidecar can then
+	//send an X-Forwarded-Client-Cert with the SPIFFE ID of another one.
+	Ranges *PrefixSet
+}
+
+//Name returns "envoy".
+func (Envoy) Name() string {
+	return "envoy"
+}
+
+//Headers returns x-envoy-external-address and the X-Forwarded-* headers.
+func (Envoy) Headers() []string {
+	return append([]string{"X-Envoy-External-Address"}, forwardingHeaders...)
+}
+
+//TrustedProxies returns the Envoy ranges.
+func (p Envoy) TrustedProxies() *PrefixSet {
+	return p.Ranges
+}
+
+//Extract reads the Envoy headers. X-Forwarded-Proto, and x-envoy-external-address or X-Forwarded-For, are required.
+func (p Envoy) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff != "" {
+		if fw.For, err = c.ParseHops(xff); err != nil {
+			return nil, err
+		}
+	}
+	external, err := c.Header(r.Header, "X-Envoy-External-Address")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case external != "":
+		if fw.Client, err = ParseHop(external); err != nil || fw.Client.Kind != HopIP {
+			return nil, ErrEnvoyExternalAddressMustBeValid
+		}
+	case len(fw.For) == 0:
+		return nil, ErrMustHaveXForwardedFor
+	case p.NumTrustedHops < len(fw.For):
+		fw.Client = fw.For[len(fw.For)-1-p.NumTrustedHops]
+	default:
+		//Without enough addresses the client is the one appended by the edge Envoy, as with NumTrustedHops 0. The peer is the
+		//Envoy sidecar, never the client.
+		fw.Client = fw.For[len(fw.For)-1]
+	}
+
+	if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Proto == "" {
+		return nil, ErrMustHaveXForwardedProto
+	}
+	if fw.Port, err = c.Header(r.Header, "X-Forwarded-Port"); err != nil {
+		return nil, err
+	}
+	id, err := c.Header(r.Header, "X-Request-Id")
+	if err != nil {
+		return nil, err
+	}
+	fw.setAttribute(AttrRequestID, id)
+
+	xfcc, err := c.ListHeader(r.Header, "X-Forwarded-Client-Cert")
+	if err != nil {
+		return nil, err
+	}
+	if xfcc == "" {
+		return fw, nil
+	}
+	elements, err := parseEnvoyXFCC(xfcc)
+	if err != nil {
+		return nil, err
+	}
+	peer := elements[len(elements)-1]
+	fw.Identity = &ClientIdentity{
+		By:       peer["By"],
+		Hash:     strings.ToLower(peer.get("Hash")),
+		Subject:  peer.get("Subject"),
+		URIs:     peer["URI"],
+		DNSNames: peer["DNS"],
+		Verified: true,
+	}
+	if fw.Identity.Subject != "" {
+		if fw.Identity.SubjectName, err = ParseDistinguishedName(fw.Identity.Subject); err != nil {
+			return nil, ErrEnvoyClientCertMustBeValid
+		}
+	}
+	certs := peer.get("Chain")
+	if certs == "" {
+		certs = peer.get("Cert")
+	}
+	if certs != "" {
+		if fw.Certificates, err = parseURLEncodedPEMCertificates(certs, ErrEnvoyClientCertMustBeValid); err != nil {
+			return nil, err
+		}
+		//Complete the identity with the certificate, keeping what Envoy informed.
+		cert := identityFromCertificate(fw.Certificates[0])
+		cert.By, cert.Verified = fw.Identity.By, true
+		fw.Identity = cert
+	}
+	return fw, nil
+}
+
+//envoyXFCCElement are the fields of an Envoy X-Forwarded-Client-Cert element, by key. URI, DNS and By may be repeated.
+type envoyXFCCElement map[string][]string
+
+//get returns the first value of a field, or an empty string if absent.
+func (e envoyXFCCElement) get(key string) string {
+	if v := e[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+//parseEnvoyXFCC parses an Envoy X-Forwarded-Client-Cert: elements separated by ",", with key=value fields separated by ";".
+//Values can be double-quoted, to contain ",", ";" and "=", with \" as the escape of a double quote.
+func parseEnvoyXFCC(s string) ([]envoyXFCCElement, error) {
+	var elements []envoyXFCCElement
+	element := envoyXFCCElement{}
+	var key string
+	var field strings.Builder
+	inKey, quoted := true, false
+	//endField stores the key or value being read, returning false if the field is malformed.
+	endField := func() bool {
+		v := strings.TrimSpace(field.String())
+		field.Reset()
+		if inKey {
+			return v == ""
+		}
+		if key == "" {
+			return false
+		}
+		element[key] = append(element[key], v)
+		inKey = true
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quoted && ch == '\\' && i+1 < len(s) && s[i+1] == '"':
+			field.WriteByte('"')
+			i++
+		case ch == '"' && !inKey:
+			quoted = !quoted
+		case quoted:
+			field.WriteByte(ch)
+		case ch == '=' && inKey:
+			key = strings.TrimSpace(field.String())
+			field.Reset()
+			inKey = false
+		case ch == ';':
+			if !endField() {
+				return nil, ErrEnvoyClientCertMustBeValid
+			}
+		case ch == ',':
+			if !endField() || len(element) == 0 {
+				return nil, ErrEnvoyClientCertMustBeValid
+			}
+			elements = append(elements, element)
+			element = envoyXFCCElement{}
+		default:
+			field.WriteByte(ch)
+		}
+	}
+	if quoted || !endField() || len(element) == 0 {
+		return nil, ErrEnvoyClientCertMustBeValid
+	}
+	return append(elements, element), nil
+}
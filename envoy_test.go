@@ -0,0 +1,213 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestEnvoy(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.Envoy{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://httpbin.default.svc/", nil)
+	req.RemoteAddr = "127.0.0.6:51000"
+	req.Header.Add("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Request-Id", "5f1e4b4e-9c2a-4a57-9d6b-2a1f0e1b2c3d")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.7", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "httpbin.default.svc", pr.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "5f1e4b4e-9c2a-4a57-9d6b-2a1f0e1b2c3d", proxyheaders.Attribute(pr, proxyheaders.AttrRequestID); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "envoy", proxyheaders.PresetName(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//The edge Envoy external address has precedence.
+	req = httptest.NewRequest(http.MethodGet, "http://httpbin.default.svc/", nil)
+	req.RemoteAddr = "127.0.0.6:51000"
+	req.Header.Add("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Request-Id", "5f1e4b4e-9c2a-4a57-9d6b-2a1f0e1b2c3d")
+	req.Header.Add("X-Envoy-External-Address", "192.0.2.9")
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "192.0.2.9", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "", pr.Header.Get("X-Envoy-External-Address"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://httpbin.default.svc/", nil)
+	req.RemoteAddr = "127.0.0.6:51000"
+	req.Header.Add("X-Forwarded-For", "198.51.100.1")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Request-Id", "5f1e4b4e-9c2a-4a57-9d6b-2a1f0e1b2c3d")
+	req.Header.Set("X-Envoy-External-Address", "not-an-ip")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrEnvoyExternalAddressMustBeValid, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestEnvoy_numTrustedHops(t *testing.T) {
+	tests := []struct {
+		hops int
+		xff  string
+		want string
+	}{
+		{0, "192.0.2.1, 198.51.100.1, 203.0.113.7", "203.0.113.7"},
+		{1, "192.0.2.1, 198.51.100.1, 203.0.113.7", "198.51.100.1"},
+		{2, "192.0.2.1, 198.51.100.1, 203.0.113.7", "192.0.2.1"},
+		//Not enough addresses, the rightmost is used, not the sidecar.
+		{3, "192.0.2.1, 198.51.100.1, 203.0.113.7", "203.0.113.7"},
+		{1, "203.0.113.7", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		c := &proxyheaders.Config{Preset: proxyheaders.Envoy{NumTrustedHops: tt.hops}}
+		req := httptest.NewRequest(http.MethodGet, "http://httpbin.default.svc/", nil)
+		req.RemoteAddr = "127.0.0.6:51000"
+		req.Header.Add("X-Forwarded-For", tt.xff)
+		req.Header.Add("X-Forwarded-Proto", "https")
+		req.Header.Add("X-Request-Id", "5f1e4b4e-9c2a-4a57-9d6b-2a1f0e1b2c3d")
+		pr, err := c.NewProxiedRequest(req)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("hops=%d: want=%v, got=%v", tt.hops, want, got)
+		}
+		if want, got := tt.want, pr.RemoteAddr; want != got {
+			t.Fatalf("hops=%d: want=%s, got=%s", tt.hops, want, got)
+		}
+	}
+}
+
+func TestEnvoy_clientCert(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.Envoy{}}
+
+	//Istio forwards the identities, but not the certificate.
+	req := httptest.NewRequest(http.MethodGet, "http://httpbin.default.svc/", nil)
+	req.RemoteAddr = "127.0.0.6:51000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Request-Id", "5f1e4b4e-9c2a-4a57-9d6b-2a1f0e1b2c3d")
+	req.Header.Add("X-Forwarded-Client-Cert", `By=spiffe://cluster.local/ns/foo/sa/gateway;Hash=AB12;Subject="";URI=spiffe://cluster.local/ns/bar/sa/edge,`+
+		`By=spiffe://cluster.local/ns/default/sa/httpbin;Hash=0F1E;Subject="CN=sleep,O=Example\, Inc.";URI=spiffe://cluster.local/ns/default/sa/sleep;DNS=sleep.default`)
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	id := proxyheaders.Identity(pr)
+	if want, got := "spiffe://cluster.local/ns/default/sa/sleep", id.SPIFFEID(); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "spiffe://cluster.local/ns/default/sa/httpbin", id.By[0]; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := `CN=sleep,O=Example\, Inc.`, id.Subject; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "Example, Inc.", id.SubjectName.Organization[0]; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "0f1e", id.Hash; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "sleep.default", id.DNSNames[0]; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := true, id.Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := true, proxyheaders.AssertedFields(pr).Has(proxyheaders.FieldClientCert); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	//With the certificate, it is in the TLS state.
+	ca, caKey := newCert(t, "ca", true, nil, nil)
+	leaf, _ := newCert(t, "client", false, ca, caKey)
+	req = httptest.NewRequest(http.MethodGet, "http://httpbin.default.svc/", nil)
+	req.RemoteAddr = "127.0.0.6:51000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Request-Id", "5f1e4b4e-9c2a-4a57-9d6b-2a1f0e1b2c3d")
+	req.Header.Add("X-Forwarded-Client-Cert", `By=spiffe://cluster.local/ns/default/sa/httpbin;Cert="`+url.PathEscape(pemEncode(leaf))+`"`)
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := true, certificatesAreEqual([]*x509.Certificate{leaf}, pr.TLS.PeerCertificates); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "CN=client", proxyheaders.Identity(pr).Subject; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//A certificate that fails the verification, in report only mode, is not verified, even if Envoy asserted it.
+	other, _ := newCert(t, "other ca", true, nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(other)
+	reportOnly := &proxyheaders.Config{Preset: proxyheaders.Envoy{}, ClientCAs: pool, ReportOnly: true}
+	req = httptest.NewRequest(http.MethodGet, "http://httpbin.default.svc/", nil)
+	req.RemoteAddr = "127.0.0.6:51000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Request-Id", "5f1e4b4e-9c2a-4a57-9d6b-2a1f0e1b2c3d")
+	req.Header.Add("X-Forwarded-Client-Cert", `By=spiffe://cluster.local/ns/default/sa/httpbin;Cert="`+url.PathEscape(pemEncode(leaf))+`"`)
+	pr, err = reportOnly.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := false, proxyheaders.Identity(pr).Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := 1, len(proxyheaders.Violations(pr)); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	for _, xfcc := range []string{
+		`By=spiffe://a;URI`,
+		`By=spiffe://a;Subject="unterminated`,
+		`By=spiffe://a,,URI=spiffe://b`,
+		`By=spiffe://a;Cert=invalid`,
+	} {
+		req = httptest.NewRequest(http.MethodGet, "http://httpbin.default.svc/", nil)
+		req.RemoteAddr = "127.0.0.6:51000"
+		req.Header.Add("X-Forwarded-For", "203.0.113.7")
+		req.Header.Add("X-Forwarded-Proto", "https")
+		req.Header.Add("X-Request-Id", "5f1e4b4e-9c2a-4a57-9d6b-2a1f0e1b2c3d")
+		req.Header.Add("X-Forwarded-Client-Cert", xfcc)
+		_, err = c.NewProxiedRequest(req)
+		if want, got := proxyheaders.ErrEnvoyClientCertMustBeValid, err; want != got {
+			t.Fatalf("xfcc=%s: want=%v, got=%v", xfcc, want, got)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import "strings"
+
+//Field is a set of request fields that can be asserted by a proxy.
+type Field uint
+
+const (
+	//FieldClientIP is the client address, in http.Request.RemoteAddr.
+	FieldClientIP Field = 1 << iota
+	//FieldHost is the host the client asked for, in http.Request.Host.
+	FieldHost
+	//FieldProto is the protocol the client used, in http.Request.URL.Scheme and http.Request.TLS.
+	FieldProto
+	//FieldClientCert is the client certificate, in http.Request.TLS.PeerCertificates and Identity.
+	FieldClientCert
+)
+
+//fieldNames are the names of each field, in bit order.
+var fieldNames = []string{"ip", "host", "proto", "cert"}
+
+//Has reports if all the fields in other are in f.
+func (f Field) Has(other Field) bool {
+	return f&other == other
+}
+
+//String returns the field names separated by "|", like "ip|host|proto".
+func (f Field) String() string {
+	names := make([]string, 0, len(fieldNames))
+	for i, n := range fieldNames {
+		if f&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,38 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestField(t *testing.T) {
+	f := proxyheaders.FieldClientIP | proxyheaders.FieldProto | proxyheaders.FieldClientCert
+	if want, got := "ip|proto|cert", f.String(); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := true, f.Has(proxyheaders.FieldClientIP|proxyheaders.FieldClientCert); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := false, f.Has(proxyheaders.FieldHost|proxyheaders.FieldClientCert); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "", proxyheaders.Field(0).String(); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+}
@@ -0,0 +1,279 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//Errors returned by the Google Cloud preset.
+var (
+	//ErrGoogleXForwardedForMustHaveClient is returned when the X-Forwarded-For header has not the client and the load balancer
+	//addresses appended by the Google Cloud load balancer.
+	ErrGoogleXForwardedForMustHaveClient = errors.New("proxyheaders: X-Forwarded-For must end with the client and the load balancer addresses")
+	//ErrClientCertHeadersMustBeValid is returned when the X-Client-Cert-* headers of the Google Cloud preset cannot be parsed.
+	ErrClientCertHeadersMustBeValid = errors.New("proxyheaders: X-Client-Cert-* headers must be valid")
+)
+
+//Well-known names of Forwarded.Attributes for the client geolocation, besides AttrCountry.
+const (
+	//AttrSubdivision is the country subdivision of the client, like "USCA", as geolocated by the proxy.
+	AttrSubdivision = "subdivision"
+	//AttrCity is the city of the client, as geolocated by the proxy.
+	AttrCity = "city"
+	//AttrLatLong is the latitude and longitude of the client city, like "37.386051,-122.083851", as geolocated by the proxy.
+	AttrLatLong = "lat-long"
+)
+
+//googleHeaders are the custom headers of the Google Cloud preset.
+var googleHeaders = []string{
+	"X-Client-Geo-Region",
+	"X-Client-Geo-Subdivision",
+	"X-Client-Geo-City",
+	"X-Client-Geo-Latlong",
+	"X-Client-Cert-Present",
+	"X-Client-Cert-Chain-Verified",
+	"X-Client-Cert-Error",
+	"X-Client-Cert-Hash",
+	"X-Client-Cert-Serial-Number",
+	"X-Client-Cert-Subject-DN",
+	"X-Client-Cert-Issuer-DN",
+	"X-Client-Cert-SPIFFE",
+	"X-Client-Cert-URI-SANs",
+	"X-Client-Cert-DNSName-SANs",
+	"X-Client-Cert-Valid-Not-Before",
+	"X-Client-Cert-Valid-Not-After",
+	"X-Client-Cert-Leaf",
+}
+
+//googleRanges are the Google Front End ranges of the global external load balancers.
+var googleRanges = mustReadPrefixList([]byte("35.191.0.0/16\n130.211.0.0/22"))
+
+//Google is the Preset for requests proxied by Google Cloud load balancers, including the ones behind Identity-Aware Proxy.
+//
+//The load balancer appends "client, load balancer" to X-Forwarded-For, so the client is the second address from the right.
+//The protocol comes from X-Forwarded-Proto. The host is the Host header, that the load balancer matched its URL map
+//against. The trace context (X-Cloud-Trace-Context) is available with Attribute, as AttrTraceID, and left in the request
+//so the Cloud Trace propagators continue the trace of the load balancer.
+//
+//The custom request headers configured in the backend service are read with these names:
+//
+//	X-Client-Geo-Region: {client_region}
+//	X-Client-Geo-Subdivision: {client_region_subdivision}
+//	X-Client-Geo-City: {client_city}
+//	X-Client-Geo-Latlong: {client_city_lat_long}
+//	X-Client-Cert-Present: {client_cert_present}
+//	X-Client-Cert-Chain-Verified: {client_cert_chain_verified}
+//	X-Client-Cert-Error: {client_cert_error}
+//	X-Client-Cert-Hash: {client_cert_sha256_fingerprint}
+//	X-Client-Cert-Serial-Number: {client_cert_serial_number}
+//	X-Client-Cert-Subject-DN: {client_cert_subject_dn}
+//	X-Client-Cert-Issuer-DN: {client_cert_issuer_dn}
+//	X-Client-Cert-SPIFFE: {client_cert_spiffe_id}
+//	X-Client-Cert-URI-SANs: {client_cert_uri_sans}
+//	X-Client-Cert-DNSName-SANs: {client_cert_dnsname_sans}
+//	X-Client-Cert-Valid-Not-Before: {client_cert_valid_not_before}
+//	X-Client-Cert-Valid-Not-After: {client_cert_valid_not_after}
+//	X-Client-Cert-Leaf: {client_cert_leaf}
+//
+//The geolocation is available with Attribute, as AttrCountry, AttrSubdivision, AttrCity and AttrLatLong. When the client
+//presented a certificate, the mutual TLS fields are available with Identity, verified as informed by the load balancer, and
+//the leaf certificate, if forwarded, is in http.Request.TLS.
+//
+//The Identity-Aware Proxy headers (X-Goog-Authenticated-User-Email, X-Goog-IAP-JWT-Assertion...) are kept in the request:
+//only the signed X-Goog-IAP-JWT-Assertion, once verified, can be trusted.
+type Google struct {
+	//Ranges are the load balancer addresses trusted to send the headers, like the proxy-only subnet of regional load balancers.
+	//If nil, the Google Front End ranges 35.191.0.0/16 and 130.211.0.0/22 are used.
+	Ranges *PrefixSet
+}
+
+//Name returns "google".
+func (Google) Name() string {
+	return "google"
+}
+
+//Headers returns the custom headers and the X-Forwarded-* ones.
+func (Google) Headers() []string {
+	return append(append([]string(nil), googleHeaders...), forwardingHeaders...)
+}
+
+//TrustedProxies returns the load balancer ranges.
+func (p Google) TrustedProxies() *PrefixSet {
+	if p.Ranges == nil {
+		return googleRanges
+	}
+	return p.Ranges
+}
+
+//Extract reads the Google Cloud headers. X-Forwarded-For, with at least two addresses, and X-Forwarded-Proto are required.
+func (Google) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff == "" {
+		return nil, ErrMustHaveXForwardedFor
+	}
+	if fw.For, err = c.ParseHops(xff); err != nil {
+		return nil, err
+	}
+	if len(fw.For) < 2 {
+		return nil, ErrGoogleXForwardedForMustHaveClient
+	}
+	fw.Client = fw.For[len(fw.For)-2]
+	if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Proto == "" {
+		return nil, ErrMustHaveXForwardedProto
+	}
+	trace, err := c.Header(r.Header, "X-Cloud-Trace-Context")
+	if err != nil {
+		return nil, err
+	}
+	fw.setAttribute(AttrTraceID, trace)
+
+	v := make(map[string]string, len(googleHeaders))
+	for _, h := range googleHeaders {
+		if v[h], err = c.Header(r.Header, h); err != nil {
+			return nil, err
+		}
+	}
+	fw.setAttribute(AttrCountry, v["X-Client-Geo-Region"])
+	fw.setAttribute(AttrSubdivision, v["X-Client-Geo-Subdivision"])
+	fw.setAttribute(AttrCity, v["X-Client-Geo-City"])
+	fw.setAttribute(AttrLatLong, v["X-Client-Geo-Latlong"])
+
+	//Without a client certificate the other mutual TLS headers are empty.
+	if !strings.EqualFold(v["X-Client-Cert-Present"], "true") {
+		return fw, nil
+	}
+	if fw.Identity, err = googleIdentity(v); err != nil {
+		return nil, err
+	}
+	if leaf := strings.Trim(v["X-Client-Cert-Leaf"], ":"); leaf != "" {
+		cert, err := parseBase64DERCertificate(leaf, ErrClientCertHeadersMustBeValid)
+		if err != nil {
+			return nil, err
+		}
+		fw.Certificates = append(fw.Certificates, cert)
+	}
+	return fw, nil
+}
+
+//googleIdentity builds the client identity from the X-Client-Cert-* headers.
+func googleIdentity(v map[string]string) (*ClientIdentity, error) {
+	id := &ClientIdentity{
+		Verified:     strings.EqualFold(v["X-Client-Cert-Chain-Verified"], "true"),
+		Error:        v["X-Client-Cert-Error"],
+		SerialNumber: strings.ToUpper(v["X-Client-Cert-Serial-Number"]),
+	}
+	var err error
+	if id.Hash, err = googleHash(v["X-Client-Cert-Hash"]); err != nil {
+		return nil, err
+	}
+	if id.SubjectName, err = googleDN(v["X-Client-Cert-Subject-DN"]); err != nil {
+		return nil, err
+	}
+	if id.IssuerName, err = googleDN(v["X-Client-Cert-Issuer-DN"]); err != nil {
+		return nil, err
+	}
+	id.Subject, id.Issuer = id.SubjectName.String(), id.IssuerName.String()
+	if id.URIs, err = googleSANs(v["X-Client-Cert-URI-SANs"]); err != nil {
+		return nil, err
+	}
+	if spiffe := v["X-Client-Cert-SPIFFE"]; spiffe != "" && id.SPIFFEID() == "" {
+		id.URIs = append(id.URIs, spiffe)
+	}
+	if id.DNSNames, err = googleSANs(v["X-Client-Cert-DNSName-SANs"]); err != nil {
+		return nil, err
+	}
+	if id.NotBefore, err = googleTime(v["X-Client-Cert-Valid-Not-Before"]); err != nil {
+		return nil, err
+	}
+	if id.NotAfter, err = googleTime(v["X-Client-Cert-Valid-Not-After"]); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+//googleHash converts the base64 SHA-256 fingerprint to lowercase hexadecimal.
+func googleHash(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	hash, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", ErrClientCertHeadersMustBeValid
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+//googleDN parses a base64 DER distinguished name.
+func googleDN(s string) (pkix.Name, error) {
+	var name pkix.Name
+	if s == "" {
+		return name, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return name, ErrClientCertHeadersMustBeValid
+	}
+	var seq pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(der, &seq); err != nil || len(rest) > 0 {
+		return name, ErrClientCertHeadersMustBeValid
+	}
+	name.FillFromRDNSequence(&seq)
+	return name, nil
+}
+
+//googleSANs decodes a comma-separated list of base64 subject alternative names.
+func googleSANs(s string) ([]string, error) {
+	var sans []string
+	for _, san := range strings.Split(s, ",") {
+		if san = strings.TrimSpace(san); san == "" {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(san)
+		if err != nil {
+			return nil, ErrClientCertHeadersMustBeValid
+		}
+		sans = append(sans, string(b))
+	}
+	return sans, nil
+}
+
+//googleTime parses an RFC 3339 timestamp. An empty s results in a zero time.
+func googleTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, ErrClientCertHeadersMustBeValid
+	}
+	return t, nil
+}
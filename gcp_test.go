@@ -0,0 +1,181 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+//base64DN encodes a name like {client_cert_subject_dn}.
+func base64DN(t *testing.T, name pkix.Name) string {
+	t.Helper()
+	der, err := asn1.Marshal(name.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func TestGoogle(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.Google{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "35.191.10.1:40000"
+	req.Header.Add("X-Forwarded-For", "192.0.2.1, 203.0.113.7, 34.120.1.1")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	req.Header.Add("X-Client-Geo-Region", "US")
+	req.Header.Add("X-Client-Geo-City", "Mountain View")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.7", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "www.example.com", pr.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "US", proxyheaders.Attribute(pr, proxyheaders.AttrCountry); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "Mountain View", proxyheaders.Attribute(pr, proxyheaders.AttrCity); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "105445aa7843bc8bf206b12000100000/1;o=1", proxyheaders.Attribute(pr, proxyheaders.AttrTraceID); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "google", proxyheaders.PresetName(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := (*proxyheaders.ClientIdentity)(nil), proxyheaders.Identity(pr); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	//The load balancer always appends two addresses.
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "35.191.10.1:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrGoogleXForwardedForMustHaveClient, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	//Requests not coming from the Google Front Ends.
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "35.191.10.1:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7, 34.120.1.1")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	req.RemoteAddr = "198.51.100.1:40000"
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrProxyMustBeTrusted, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestGoogle_clientCert(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.Google{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "35.191.10.1:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7, 34.120.1.1")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	req.Header.Add("X-Client-Cert-Present", "true")
+	req.Header.Add("X-Client-Cert-Chain-Verified", "true")
+	req.Header.Add("X-Client-Cert-Hash", base64.StdEncoding.EncodeToString([]byte{0xab, 0xcd}))
+	req.Header.Add("X-Client-Cert-Serial-Number", "0a1b")
+	req.Header.Add("X-Client-Cert-Subject-DN", base64DN(t, pkix.Name{CommonName: "client", Organization: []string{"Example"}}))
+	req.Header.Add("X-Client-Cert-Issuer-DN", base64DN(t, pkix.Name{CommonName: "Example CA"}))
+	req.Header.Add("X-Client-Cert-URI-SANs", base64.StdEncoding.EncodeToString([]byte("spiffe://example.com/client"))+","+
+		base64.StdEncoding.EncodeToString([]byte("https://example.com/client")))
+	req.Header.Add("X-Client-Cert-DNSName-SANs", base64.StdEncoding.EncodeToString([]byte("client.example.com")))
+	req.Header.Add("X-Client-Cert-Valid-Not-After", "2050-01-01T00:00:00Z")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	id := proxyheaders.Identity(pr)
+	if want, got := "CN=client,O=Example", id.Subject; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "Example CA", id.IssuerName.CommonName; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "0A1B", id.SerialNumber; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "abcd", id.Hash; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "spiffe://example.com/client", id.SPIFFEID(); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := 2, len(id.URIs); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := "client.example.com", id.DNSNames[0]; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := 2050, id.NotAfter.Year(); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := true, id.Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := true, proxyheaders.AssertedFields(pr).Has(proxyheaders.FieldClientCert); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "", pr.Header.Get("X-Client-Cert-Subject-DN"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//A certificate not verified by the load balancer.
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "35.191.10.1:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7, 34.120.1.1")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	req.Header.Add("X-Client-Cert-Present", "true")
+	req.Header.Add("X-Client-Cert-Chain-Verified", "false")
+	req.Header.Add("X-Client-Cert-Error", "client_cert_chain_invalid_eku")
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := false, proxyheaders.Identity(pr).Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "client_cert_chain_invalid_eku", proxyheaders.Identity(pr).Error; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req.Header.Set("X-Client-Cert-Subject-DN", "CN=client")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrClientCertHeadersMustBeValid, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
@@ -0,0 +1,177 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//ErrSSLClientMustBeValid is returned when the X-SSL-Client-* headers of the HAProxy preset cannot be parsed.
+//The errors of the distinguished names wrap this one, with the header name and the parsing error.
+var ErrSSLClientMustBeValid = errors.New("proxyheaders: X-SSL-Client-* headers must be valid")
+
+//haproxyHeaders are the client certificate headers of the HAProxy preset.
+var haproxyHeaders = []string{
+	"X-SSL-Client-Verify",
+	"X-SSL-Client-DN",
+	"X-SSL-Client-CN",
+	"X-SSL-Issuer",
+	"X-SSL-Client-NotBefore",
+	"X-SSL-Client-NotAfter",
+	"X-SSL-Client-Cert",
+}
+
+//HAProxy is the Preset for requests proxied by HAProxy, with the client certificate headers of its documentation:
+//
+//	http-request set-header X-SSL-Client-Verify    %[ssl_c_verify]
+//	http-request set-header X-SSL-Client-DN        %{+Q}[ssl_c_s_dn]
+//	http-request set-header X-SSL-Client-CN        %{+Q}[ssl_c_s_dn(cn)]
+//	http-request set-header X-SSL-Issuer           %{+Q}[ssl_c_i_dn]
+//	http-request set-header X-SSL-Client-NotBefore %{+Q}[ssl_c_notbefore]
+//	http-request set-header X-SSL-Client-NotAfter  %{+Q}[ssl_c_notafter]
+//	http-request set-header X-SSL-Client-Cert      %[ssl_c_der,base64]
+//
+//The client address, protocol and port come from X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Port ("option forwardfor"),
+//and the TLS facts from X-SSL-Protocol and X-SSL-Cipher (see NewProxiedRequest). HAProxy sends no X-Forwarded-Host by
+//default, the Host header is used, as the client sent it unless an "http-request set-header Host" rewrites it.
+//
+//The client certificate (X-SSL-Client-Cert) is in http.Request.TLS. Even when only the distinguished names are forwarded,
+//the client identity is available with Identity, verified if X-SSL-Client-Verify is "0" (or "SUCCESS").
+type HAProxy struct {
+	//Ranges are the HAProxy addresses trusted to send the headers, as a self-hosted HAProxy has no published ones. Without
+	//them (and without Config.TrustedProxies) any client reaching the application directly can send "X-SSL-Client-Verify: 0"
+	//with the distinguished name of its choice.
+	Ranges *PrefixSet
+}
+
+//Name returns "haproxy".
+func (HAProxy) Name() string {
+	return "haproxy"
+}
+
+//Headers returns the X-SSL-Client-* headers and the X-Forwarded-* ones.
+func (HAProxy) Headers() []string {
+	return append(append([]string(nil), haproxyHeaders...), forwardingHeaders...)
+}
+
+//TrustedProxies returns the HAProxy ranges.
+func (p HAProxy) TrustedProxies() *PrefixSet {
+	return p.Ranges
+}
+
+//Extract reads the HAProxy headers. X-Forwarded-For and X-Forwarded-Proto are required.
+func (HAProxy) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff == "" {
+		return nil, ErrMustHaveXForwardedFor
+	}
+	if fw.For, err = c.ParseHops(xff); err != nil {
+		return nil, err
+	}
+	if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Proto == "" {
+		return nil, ErrMustHaveXForwardedProto
+	}
+	if fw.Port, err = c.Header(r.Header, "X-Forwarded-Port"); err != nil {
+		return nil, err
+	}
+	if fw.TLS, err = c.extractTLSHeaders(r.Header); err != nil {
+		return nil, err
+	}
+
+	//Read the client certificate headers, without the quotes of %{+Q}.
+	v := make(map[string]string, len(haproxyHeaders))
+	for _, h := range haproxyHeaders {
+		value, err := c.Header(r.Header, h)
+		if err != nil {
+			return nil, err
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		v[h] = value
+	}
+	verify := strings.ToUpper(v["X-SSL-Client-Verify"])
+	verified := verify == "0" || verify == "SUCCESS"
+
+	//The certificate has all the identity...
+	if v["X-SSL-Client-Cert"] != "" {
+		cert, err := parseBase64DERCertificate(v["X-SSL-Client-Cert"], ErrSSLClientMustBeValid)
+		if err != nil {
+			return nil, err
+		}
+		fw.Certificates = append(fw.Certificates, cert)
+		fw.Identity = identityFromCertificate(cert)
+		fw.Identity.Verified = verified
+		return fw, nil
+	}
+
+	//...otherwise, it is built from the forwarded fields.
+	subject := v["X-SSL-Client-DN"]
+	if subject == "" && v["X-SSL-Client-CN"] != "" {
+		subject = "/CN=" + v["X-SSL-Client-CN"]
+	}
+	if subject == "" {
+		return fw, nil
+	}
+	id := &ClientIdentity{Verified: verified}
+	if id.SubjectName, err = ParseDistinguishedName(subject); err != nil {
+		return nil, fmt.Errorf("%w: X-SSL-Client-DN: %w", ErrSSLClientMustBeValid, err)
+	}
+	id.Subject = id.SubjectName.String()
+	if v["X-SSL-Issuer"] != "" {
+		if id.IssuerName, err = ParseDistinguishedName(v["X-SSL-Issuer"]); err != nil {
+			return nil, fmt.Errorf("%w: X-SSL-Issuer: %w", ErrSSLClientMustBeValid, err)
+		}
+		id.Issuer = id.IssuerName.String()
+	}
+	if id.NotBefore, err = parseASN1Time(v["X-SSL-Client-NotBefore"]); err != nil {
+		return nil, err
+	}
+	if id.NotAfter, err = parseASN1Time(v["X-SSL-Client-NotAfter"]); err != nil {
+		return nil, err
+	}
+	fw.Identity = id
+	return fw, nil
+}
+
+//parseASN1Time parses the ASN.1 UTCTime ("YYMMDDhhmmssZ") or GeneralizedTime ("YYYYMMDDhhmmssZ") used by HAProxy.
+//An empty s results in a zero time.
+func parseASN1Time(s string) (time.Time, error) {
+	layout := "060102150405Z0700"
+	switch {
+	case s == "":
+		return time.Time{}, nil
+	case len(s) >= 14 && s[12] != 'Z' && s[12] != '+' && s[12] != '-':
+		layout = "20060102150405Z0700"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, ErrSSLClientMustBeValid
+	}
+	return t, nil
+}
@@ -0,0 +1,207 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestHAProxy(t *testing.T) {
+	c := &proxyheaders.Config{Preset: proxyheaders.HAProxy{}}
+
+	//Only the distinguished names are forwarded.
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.0.2:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-SSL-Client-Verify", "0")
+	req.Header.Add("X-SSL-Client-DN", `"/C=US/O=Example/CN=client"`)
+	req.Header.Add("X-SSL-Client-CN", `"client"`)
+	req.Header.Add("X-SSL-Issuer", `"/C=US/O=Example/CN=Example CA"`)
+	req.Header.Add("X-SSL-Client-NotBefore", `"230921015017Z"`)
+	req.Header.Add("X-SSL-Client-NotAfter", `"20500101000000Z"`)
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.7", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "haproxy", proxyheaders.PresetName(pr); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	id := proxyheaders.Identity(pr)
+	if want, got := "CN=client,O=Example,C=US", id.Subject; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "client", id.SubjectName.CommonName; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "Example CA", id.IssuerName.CommonName; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := time.Date(2023, 9, 21, 1, 50, 17, 0, time.UTC), id.NotBefore; !want.Equal(got) {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), id.NotAfter; !want.Equal(got) {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := true, id.Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := 0, len(pr.TLS.PeerCertificates); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := true, proxyheaders.AssertedFields(pr).Has(proxyheaders.FieldClientCert); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "", pr.Header.Get("X-SSL-Client-DN"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//Only the common name.
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.0.2:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-SSL-Client-Verify", "21")
+	req.Header.Add("X-SSL-Client-CN", "client")
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "CN=client", proxyheaders.Identity(pr).Subject; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := false, proxyheaders.Identity(pr).Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.0.2:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-SSL-Client-DN", "client")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := true, errors.Is(err, proxyheaders.ErrDistinguishedNameMustBeValid); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := true, errors.Is(err, proxyheaders.ErrSSLClientMustBeValid); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.0.2:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-SSL-Client-DN", "/CN=client")
+	req.Header.Add("X-SSL-Client-NotAfter", "tomorrow")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrSSLClientMustBeValid, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestHAProxy_clientCert(t *testing.T) {
+	ca, caKey := newCert(t, "ca", true, nil, nil)
+	leaf, _ := newCert(t, "client", false, ca, caKey)
+	c := &proxyheaders.Config{Preset: proxyheaders.HAProxy{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.0.2:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-SSL-Client-Verify", "0")
+	req.Header.Add("X-SSL-Client-Cert", base64.StdEncoding.EncodeToString(leaf.Raw))
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := true, certificatesAreEqual([]*x509.Certificate{leaf}, pr.TLS.PeerCertificates); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "CN=client", proxyheaders.Identity(pr).Subject; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := true, proxyheaders.Identity(pr).Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "10.0.0.2:40000"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-SSL-Client-Cert", "bm90IGEgY2VydGlmaWNhdGU=")
+	_, err = c.NewProxiedRequest(req)
+	if want, got := proxyheaders.ErrSSLClientMustBeValid, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	for _, h := range []string{"X-SSL-Client-DN", "X-SSL-Issuer"} {
+		req = httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+		req.RemoteAddr = "10.0.0.2:40000"
+		req.Header.Add("X-Forwarded-For", "203.0.113.7")
+		req.Header.Add("X-Forwarded-Proto", "https")
+		req.Header.Add("X-SSL-Client-DN", "/CN=client")
+		req.Header.Set(h, "not a distinguished name")
+		_, err = c.NewProxiedRequest(req)
+		if !errors.Is(err, proxyheaders.ErrSSLClientMustBeValid) || !strings.Contains(err.Error(), h) {
+			t.Fatalf("%s: want=%v, got=%v", h, proxyheaders.ErrSSLClientMustBeValid, err)
+		}
+	}
+}
+
+func TestHAProxy_clientCAs(t *testing.T) {
+	ca, _ := newCert(t, "Example CA", true, nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	//The distinguished names alone, without the certificate, cannot be verified by the CAs.
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+		req.RemoteAddr = "10.0.0.2:40000"
+		req.Header.Add("X-Forwarded-For", "203.0.113.7")
+		req.Header.Add("X-Forwarded-Proto", "https")
+		req.Header.Add("X-SSL-Client-Verify", "0")
+		req.Header.Add("X-SSL-Client-DN", `"/CN=admin"`)
+		return req
+	}
+	c := &proxyheaders.Config{Preset: proxyheaders.HAProxy{}, ClientCAs: pool, RequireClientCert: true}
+	if _, err := c.NewProxiedRequest(newRequest()); !errors.Is(err, proxyheaders.ErrXForwardedClientCertMustBeVerified) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrXForwardedClientCertMustBeVerified, err)
+	}
+
+	c.ReportOnly = true
+	pr, err := c.NewProxiedRequest(newRequest())
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := false, proxyheaders.Identity(pr).Verified; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if violations := proxyheaders.Violations(pr); len(violations) != 1 || !errors.Is(violations[0], proxyheaders.ErrXForwardedClientCertMustBeVerified) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrXForwardedClientCertMustBeVerified, violations)
+	}
+}
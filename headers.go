@@ -0,0 +1,169 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//forwardingHeaders are all the headers consumed by this package.
+var forwardingHeaders = func() []string {
+	h := []string{
+		"X-Forwarded-For",
+		"X-Forwarded-Host",
+		"X-Forwarded-Proto",
+		"X-Forwarded-Port",
+		"X-Forwarded-Prefix",
+		"X-Forwarded-Client-Cert",
+	}
+	for _, names := range [][]string{tlsVersionHeaders, tlsCipherSuiteHeaders, tlsServerNameHeaders, tlsALPNHeaders} {
+		h = append(h, names...)
+	}
+	return h
+}()
+
+//StripForwardingHeaders removes from h all the headers this package consumes, reporting if any of them was present.
+//
+//It is used to remove the headers from the resolved requests and, for requests that do not come from a trusted proxy,
+//to avoid handlers reading values that could have been forged.
+func StripForwardingHeaders(h http.Header) bool {
+	stripped := false
+	for _, name := range forwardingHeaders {
+		if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+			h.Del(name)
+			stripped = true
+		}
+	}
+	return stripped
+}
+
+//StripHeaders removes from h the headers removed by StripForwardingHeaders and the ones consumed by the Preset, reporting if
+//any of them was present. A nil c is the same as a zero Config.
+//
+//Use it for requests that do not come from a trusted proxy, as a preset reads headers of its own (like CF-Connecting-IP or
+//X-SSL-Client-Verify) that could have been forged too.
+func (c *Config) StripHeaders(h http.Header) bool {
+	stripped := StripForwardingHeaders(h)
+	if c == nil {
+		return stripped
+	}
+	for _, name := range c.preset().Headers() {
+		if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+			h.Del(name)
+			stripped = true
+		}
+	}
+	return stripped
+}
+
+//DuplicatePolicy defines what to do when a header consumed by this package is repeated in more than one line.
+//
+//Repeated lines are a classic way to smuggle or spoof values, because different components may read different lines.
+type DuplicatePolicy int
+
+const (
+	//DuplicateCombine joins the lines of list headers (X-Forwarded-For) with ", ", as allowed by RFC 7230.
+	//Lines of single valued headers (X-Forwarded-Host, X-Forwarded-Proto, etc) are accepted only if all of them have
+	//the same value, otherwise a *DuplicateHeaderError is returned.
+	DuplicateCombine DuplicatePolicy = iota
+	//DuplicateTakeLast uses only the last line of any header, the one appended by the nearest proxy.
+	DuplicateTakeLast
+	//DuplicateReject returns a *DuplicateHeaderError for any repeated header, list headers included.
+	DuplicateReject
+)
+
+//String returns the policy name.
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicateCombine:
+		return "combine"
+	case DuplicateTakeLast:
+		return "take-last"
+	case DuplicateReject:
+		return "reject"
+	}
+	return fmt.Sprintf("DuplicatePolicy(%d)", int(p))
+}
+
+//DuplicateHeaderError is returned when a header is repeated in more than one line and the Config.DuplicateHeaders policy
+//does not allow it.
+//
+//It matches ErrHeaderMustNotBeDuplicated using errors.Is.
+type DuplicateHeaderError struct {
+	//Header is the canonical name of the repeated header.
+	Header string
+	//Values are all the lines received.
+	Values []string
+}
+
+//Error implements the error interface.
+func (e *DuplicateHeaderError) Error() string {
+	return fmt.Sprintf("proxyheaders: header %s must not be repeated, got %d lines", e.Header, len(e.Values))
+}
+
+//Is makes errors.Is(err, ErrHeaderMustNotBeDuplicated) true for any *DuplicateHeaderError.
+func (e *DuplicateHeaderError) Is(target error) bool {
+	return target == ErrHeaderMustNotBeDuplicated
+}
+
+//Header returns the value of the single valued header name from h, resolving repeated lines according to the
+//DuplicateHeaders policy. It returns an empty string if the header is absent.
+//
+//It is meant to be used by presets, so every header is read consistently.
+func (c *Config) Header(h http.Header, name string) (string, error) {
+	return c.headerValue(h, name, false)
+}
+
+//ListHeader returns the value of the comma separated list header name from h, resolving repeated lines according to the
+//DuplicateHeaders policy. It returns an empty string if the header is absent.
+func (c *Config) ListHeader(h http.Header, name string) (string, error) {
+	return c.headerValue(h, name, true)
+}
+
+//headerValue returns the value of the header name from h, resolving repeated lines according to the duplicate policy.
+//A nil c has the default policy, DuplicateCombine.
+func (c *Config) headerValue(h http.Header, name string, list bool) (string, error) {
+	name = http.CanonicalHeaderKey(name)
+	values := h[name]
+	switch {
+	case len(values) == 0:
+		return "", nil
+	case len(values) == 1:
+		return values[0], nil
+	}
+
+	policy := DuplicateCombine
+	if c != nil {
+		policy = c.DuplicateHeaders
+	}
+	switch policy {
+	case DuplicateTakeLast:
+		return values[len(values)-1], nil
+	case DuplicateCombine:
+		if list {
+			return strings.Join(values, ", "), nil
+		}
+		for _, v := range values[1:] {
+			if v != values[0] {
+				return "", &DuplicateHeaderError{Header: name, Values: values}
+			}
+		}
+		return values[0], nil
+	}
+	return "", &DuplicateHeaderError{Header: name, Values: values}
+}
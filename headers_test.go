@@ -0,0 +1,147 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestConfig_NewProxiedRequest_duplicateCombine(t *testing.T) {
+	c := &proxyheaders.Config{DuplicateHeaders: proxyheaders.DuplicateCombine}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-For", "5.6.7.8")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := 2, len(proxyheaders.ForwardedFor(pr)); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-For", "5.6.7.8")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Host", "evil.example.com")
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := (*http.Request)(nil), pr; want != got {
+		t.Fatalf("want=nil, got!=nil")
+	}
+	var dupErr *proxyheaders.DuplicateHeaderError
+	if !errors.As(err, &dupErr) {
+		t.Fatalf("want *DuplicateHeaderError, got %T", err)
+	}
+	if want, got := "X-Forwarded-Host", dupErr.Header; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if !errors.Is(err, proxyheaders.ErrHeaderMustNotBeDuplicated) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrHeaderMustNotBeDuplicated, err)
+	}
+}
+
+func TestConfig_Header_nilConfig(t *testing.T) {
+	var c *proxyheaders.Config
+
+	h := http.Header{}
+	h.Add("X-Forwarded-For", "1.2.3.4")
+	h.Add("X-Forwarded-For", "5.6.7.8")
+	h.Add("X-Forwarded-Proto", "https")
+	h.Add("X-Forwarded-Proto", "https")
+	h.Add("X-Forwarded-Host", "www.example.com")
+	h.Add("X-Forwarded-Host", "evil.example.com")
+	//The default policy combines the lines.
+	v, err := c.ListHeader(h, "X-Forwarded-For")
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "1.2.3.4, 5.6.7.8", v; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if v, err = c.Header(h, "X-Forwarded-Proto"); err != nil || v != "https" {
+		t.Fatalf("want=https, got=%s %v", v, err)
+	}
+	if _, err = c.Header(h, "X-Forwarded-Host"); !errors.Is(err, proxyheaders.ErrHeaderMustNotBeDuplicated) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrHeaderMustNotBeDuplicated, err)
+	}
+}
+
+func TestConfig_NewProxiedRequest_duplicateTakeLast(t *testing.T) {
+	c := &proxyheaders.Config{DuplicateHeaders: proxyheaders.DuplicateTakeLast}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-For", "5.6.7.8")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Host", "other.example.com")
+	req.Header.Add("X-Forwarded-Proto", "http")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "5.6.7.8", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "other.example.com", pr.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "http", pr.URL.Scheme; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+}
+
+func TestConfig_NewProxiedRequest_duplicateReject(t *testing.T) {
+	c := &proxyheaders.Config{DuplicateHeaders: proxyheaders.DuplicateReject}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-For", "5.6.7.8")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := (*http.Request)(nil), pr; want != got {
+		t.Fatalf("want=nil, got!=nil")
+	}
+	var dupErr *proxyheaders.DuplicateHeaderError
+	if !errors.As(err, &dupErr) {
+		t.Fatalf("want *DuplicateHeaderError, got %T", err)
+	}
+	if want, got := "X-Forwarded-For", dupErr.Header; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-SSL-Cipher", "AES128-SHA")
+	req.Header.Add("X-SSL-Cipher", "AES128-SHA")
+	_, err = c.NewProxiedRequest(req)
+	if !errors.Is(err, proxyheaders.ErrHeaderMustNotBeDuplicated) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrHeaderMustNotBeDuplicated, err)
+	}
+}
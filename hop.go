@@ -0,0 +1,230 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+//HopKind classifies an entry of a forwarding list like X-Forwarded-For.
+type HopKind int
+
+const (
+	//HopInvalid is an entry that could not be understood.
+	HopInvalid HopKind = iota
+	//HopIP is an IPv4 or IPv6 address, like "1.2.3.4", "2001:db8::1", "[2001:db8::1]" or "fe80::1%eth0".
+	HopIP
+	//HopIPPort is an address with a port, like "1.2.3.4:5678" or "[2001:db8::1]:4711".
+	HopIPPort
+	//HopObfuscated is a RFC 7239 obfuscated identifier, like "_gw1" or "_hidden:_port".
+	HopObfuscated
+	//HopUnknown is the RFC 7239 "unknown" identifier, used by proxies that do not know or do not want to tell the address.
+	HopUnknown
+)
+
+//String returns the kind name.
+func (k HopKind) String() string {
+	switch k {
+	case HopInvalid:
+		return "invalid"
+	case HopIP:
+		return "ip"
+	case HopIPPort:
+		return "ip-port"
+	case HopObfuscated:
+		return "obfuscated"
+	case HopUnknown:
+		return "unknown"
+	}
+	return fmt.Sprintf("HopKind(%d)", int(k))
+}
+
+//Hop is a parsed entry of a forwarding list.
+type Hop struct {
+	//Kind is the classification of the entry.
+	Kind HopKind
+	//Addr is the address for HopIP and HopIPPort. IPv4-mapped IPv6 addresses ("::ffff:10.0.0.1") are normalized to IPv4.
+	Addr netip.Addr
+	//Port is the port for HopIPPort.
+	Port uint16
+	//Raw is the entry as received, without surrounding spaces and quotes.
+	Raw string
+}
+
+//HasAddr reports if the hop identifies an IP address, with or without port.
+func (h Hop) HasAddr() bool {
+	return h.Kind == HopIP || h.Kind == HopIPPort
+}
+
+//String formats the hop like http.Request.RemoteAddr: "ip", "ip:port", "[ipv6]:port", or the raw identifier for obfuscated
+//and unknown hops.
+func (h Hop) String() string {
+	switch h.Kind {
+	case HopIP:
+		return h.Addr.String()
+	case HopIPPort:
+		return netip.AddrPortFrom(h.Addr, h.Port).String()
+	case HopUnknown:
+		return "unknown"
+	}
+	return h.Raw
+}
+
+//HopError is returned when an entry of X-Forwarded-For cannot be parsed and the Config.InvalidHops policy does not allow
+//skipping it.
+//
+//It matches ErrXForwardedForMustBeValid using errors.Is.
+type HopError struct {
+	//Value is the offending entry.
+	Value string
+}
+
+//Error implements the error interface.
+func (e *HopError) Error() string {
+	return fmt.Sprintf("proxyheaders: invalid X-Forwarded-For entry %q", e.Value)
+}
+
+//Is makes errors.Is(err, ErrXForwardedForMustBeValid) true for any *HopError.
+func (e *HopError) Is(target error) bool {
+	return target == ErrXForwardedForMustBeValid
+}
+
+//InvalidHopPolicy defines what to do with X-Forwarded-For entries that cannot be parsed.
+type InvalidHopPolicy int
+
+const (
+	//InvalidHopReject returns a *HopError for any invalid entry.
+	InvalidHopReject InvalidHopPolicy = iota
+	//InvalidHopSkip ignores invalid entries, as if they were not in the list.
+	InvalidHopSkip
+)
+
+//String returns the policy name.
+func (p InvalidHopPolicy) String() string {
+	switch p {
+	case InvalidHopReject:
+		return "reject"
+	case InvalidHopSkip:
+		return "skip"
+	}
+	return fmt.Sprintf("InvalidHopPolicy(%d)", int(p))
+}
+
+//ParseHop parses an entry of a forwarding list (X-Forwarded-For or the RFC 7239 "for" and "by" parameters).
+//
+//In case of error the returned hop has the HopInvalid kind and the error is a *HopError.
+func ParseHop(s string) (Hop, error) {
+	raw := strings.TrimSpace(s)
+	if len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+		raw = raw[1 : len(raw)-1]
+	}
+	invalid := Hop{Kind: HopInvalid, Raw: raw}
+
+	//Bare addresses, IPv4 or IPv6 (with or without zone).
+	if addr, err := netip.ParseAddr(raw); err == nil {
+		return Hop{Kind: HopIP, Addr: addr.Unmap(), Raw: raw}, nil
+	}
+
+	//Bracketed IPv6 without port.
+	if strings.HasPrefix(raw, "[") && strings.HasSuffix(raw, "]") {
+		addr, err := netip.ParseAddr(raw[1 : len(raw)-1])
+		if err != nil || !addr.Is6() {
+			return invalid, &HopError{Value: s}
+		}
+		return Hop{Kind: HopIP, Addr: addr.Unmap(), Raw: raw}, nil
+	}
+
+	//Node names, with optional port.
+	node, port := raw, ""
+	if i := strings.LastIndexByte(raw, ':'); i >= 0 {
+		node, port = raw[:i], raw[i+1:]
+		if !validNodePort(port) {
+			return invalid, &HopError{Value: s}
+		}
+	}
+	switch {
+	case strings.EqualFold(node, "unknown"):
+		return Hop{Kind: HopUnknown, Raw: raw}, nil
+	case isObfuscated(node):
+		return Hop{Kind: HopObfuscated, Raw: raw}, nil
+	case strings.HasPrefix(port, "_"):
+		//Addresses with obfuscated ports are reduced to the address.
+		if h, err := ParseHop(node); err == nil && h.Kind == HopIP {
+			return Hop{Kind: HopIP, Addr: h.Addr, Raw: raw}, nil
+		}
+		return invalid, &HopError{Value: s}
+	}
+
+	//Addresses with ports.
+	if strings.HasPrefix(node, "[") != strings.HasSuffix(node, "]") {
+		return invalid, &HopError{Value: s}
+	}
+	addr, err := netip.ParseAddr(strings.Trim(node, "[]"))
+	if err != nil || (addr.Is6() && !strings.HasPrefix(node, "[")) {
+		return invalid, &HopError{Value: s}
+	}
+	n, _ := strconv.ParseUint(port, 10, 16)
+	return Hop{Kind: HopIPPort, Addr: addr.Unmap(), Port: uint16(n), Raw: raw}, nil
+}
+
+//validNodePort reports if p is a RFC 7239 node-port: a port number or an obfuscated port.
+func validNodePort(p string) bool {
+	if isObfuscated(p) {
+		return true
+	}
+	if p == "" || len(p) > 5 {
+		return false
+	}
+	n, err := strconv.ParseUint(p, 10, 16)
+	return err == nil && n <= 65535
+}
+
+//isObfuscated reports if s is a RFC 7239 obfuscated identifier: "_" followed by ALPHA, DIGIT, ".", "_" or "-".
+func isObfuscated(s string) bool {
+	if len(s) < 2 || s[0] != '_' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+//ParseHops parses a comma separated forwarding list, from the client (left) to the nearest proxy (right), applying the
+//InvalidHops policy. A list without any valid hop is an error.
+func (c *Config) ParseHops(list string) ([]Hop, error) {
+	entries := strings.Split(list, ",")
+	hops := make([]Hop, 0, len(entries))
+	for _, e := range entries {
+		h, err := ParseHop(e)
+		if err != nil {
+			if c.InvalidHops == InvalidHopSkip {
+				continue
+			}
+			return nil, err
+		}
+		hops = append(hops, h)
+	}
+	if len(hops) == 0 {
+		return nil, &HopError{Value: list}
+	}
+	return hops, nil
+}
@@ -0,0 +1,129 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestParseHop(t *testing.T) {
+	tests := []struct {
+		s      string
+		kind   proxyheaders.HopKind
+		addr   string
+		port   uint16
+		string string
+	}{
+		{"1.2.3.4", proxyheaders.HopIP, "1.2.3.4", 0, "1.2.3.4"},
+		{" 1.2.3.4 ", proxyheaders.HopIP, "1.2.3.4", 0, "1.2.3.4"},
+		{"1.2.3.4:5678", proxyheaders.HopIPPort, "1.2.3.4", 5678, "1.2.3.4:5678"},
+		{"2001:db8::1", proxyheaders.HopIP, "2001:db8::1", 0, "2001:db8::1"},
+		{"[2001:db8::1]", proxyheaders.HopIP, "2001:db8::1", 0, "2001:db8::1"},
+		{"[2001:db8::1]:4711", proxyheaders.HopIPPort, "2001:db8::1", 4711, "[2001:db8::1]:4711"},
+		{`"[2001:db8::1]:4711"`, proxyheaders.HopIPPort, "2001:db8::1", 4711, "[2001:db8::1]:4711"},
+		{"fe80::1%eth0", proxyheaders.HopIP, "fe80::1%eth0", 0, "fe80::1%eth0"},
+		{"[fe80::1%eth0]:80", proxyheaders.HopIPPort, "fe80::1%eth0", 80, "[fe80::1%eth0]:80"},
+		{"::ffff:10.0.0.1", proxyheaders.HopIP, "10.0.0.1", 0, "10.0.0.1"},
+		{"[::ffff:10.0.0.1]:80", proxyheaders.HopIPPort, "10.0.0.1", 80, "10.0.0.1:80"},
+		{"1.2.3.4:_port", proxyheaders.HopIP, "1.2.3.4", 0, "1.2.3.4"},
+		{"unknown", proxyheaders.HopUnknown, "", 0, "unknown"},
+		{"UNKNOWN:80", proxyheaders.HopUnknown, "", 0, "unknown"},
+		{"_gw1", proxyheaders.HopObfuscated, "", 0, "_gw1"},
+		{"_hidden:_port", proxyheaders.HopObfuscated, "", 0, "_hidden:_port"},
+	}
+	for _, tt := range tests {
+		h, err := proxyheaders.ParseHop(tt.s)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("%q: want=%v, got=%v", tt.s, want, got)
+		}
+		if want, got := tt.kind, h.Kind; want != got {
+			t.Fatalf("%q: want=%s, got=%s", tt.s, want, got)
+		}
+		if tt.addr != "" {
+			if want, got := netip.MustParseAddr(tt.addr), h.Addr; want != got {
+				t.Fatalf("%q: want=%s, got=%s", tt.s, want, got)
+			}
+		}
+		if want, got := tt.port, h.Port; want != got {
+			t.Fatalf("%q: want=%d, got=%d", tt.s, want, got)
+		}
+		if want, got := tt.string, h.String(); want != got {
+			t.Fatalf("%q: want=%s, got=%s", tt.s, want, got)
+		}
+	}
+}
+
+func TestParseHop_failInvalid(t *testing.T) {
+	for _, s := range []string{"", "1.2.3", "1.2.3.4:", "1.2.3.4:99999", "2001:db8::1:80x", "[1.2.3.4]", "[2001:db8::1", "example.com", "_", "_gw 1", "2001:db8::zz"} {
+		h, err := proxyheaders.ParseHop(s)
+		if want, got := proxyheaders.HopInvalid, h.Kind; want != got {
+			t.Fatalf("%q: want=%s, got=%s", s, want, got)
+		}
+		var hopErr *proxyheaders.HopError
+		if !errors.As(err, &hopErr) {
+			t.Fatalf("%q: want *HopError, got %T", s, err)
+		}
+		if !errors.Is(err, proxyheaders.ErrXForwardedForMustBeValid) {
+			t.Fatalf("%q: want=%v, got=%v", s, proxyheaders.ErrXForwardedForMustBeValid, err)
+		}
+	}
+}
+
+func TestConfig_NewProxiedRequest_invalidHops(t *testing.T) {
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.Header.Add("X-Forwarded-For", "garbage, [2001:db8::1]:4711, _gw1")
+		req.Header.Add("X-Forwarded-Host", "www.example.com")
+		req.Header.Add("X-Forwarded-Proto", "https")
+		return req
+	}
+
+	pr, err := proxyheaders.NewProxiedRequest(newRequest())
+	if want, got := (*http.Request)(nil), pr; want != got {
+		t.Fatalf("want=nil, got!=nil")
+	}
+	if !errors.Is(err, proxyheaders.ErrXForwardedForMustBeValid) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrXForwardedForMustBeValid, err)
+	}
+
+	c := &proxyheaders.Config{InvalidHops: proxyheaders.InvalidHopSkip}
+	pr, err = c.NewProxiedRequest(newRequest())
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "[2001:db8::1]:4711", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	hops := proxyheaders.ForwardedFor(pr)
+	if want, got := 2, len(hops); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := proxyheaders.HopObfuscated, hops[1].Kind; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req := newRequest()
+	req.Header.Set("X-Forwarded-For", "garbage, more garbage")
+	if _, err := c.NewProxiedRequest(req); !errors.Is(err, proxyheaders.ErrXForwardedForMustBeValid) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrXForwardedForMustBeValid, err)
+	}
+}
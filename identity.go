@@ -0,0 +1,102 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//ClientIdentity is the identity of the client certificate, as asserted by the proxy or read from the certificate itself.
+//
+//Some proxies only forward the certificate fields (subject, issuer, serial number...) instead of the certificate, so the
+//identity is the common ground to authorize clients, whatever the proxy.
+type ClientIdentity struct {
+	//Subject is the subject distinguished name, like "CN=client,O=Example".
+	Subject string
+	//Issuer is the issuer distinguished name, like "CN=Example CA,O=Example".
+	Issuer string
+	//SubjectName and IssuerName are Subject and Issuer parsed, see ParseDistinguishedName.
+	SubjectName, IssuerName pkix.Name
+	//SerialNumber is the serial number, in uppercase hexadecimal, like "0A1B".
+	SerialNumber string
+	//NotBefore and NotAfter are the validity period. Zero values are unknown.
+	NotBefore, NotAfter time.Time
+	//URIs are the URI subject alternative names, like the SPIFFE ID "spiffe://cluster.local/ns/default/sa/client".
+	URIs []string
+	//DNSNames are the DNS subject alternative names.
+	DNSNames []string
+	//Hash is the SHA-256 of the DER certificate, in lowercase hexadecimal.
+	Hash string
+	//By are the URI subject alternative names of the proxy that received the certificate (the Envoy XFCC By), usually the
+	//identity of this server.
+	By []string
+	//Verified is true when the proxy asserts it verified the certificate, or when it was verified against Config.ClientCAs.
+	Verified bool
+	//Error is the verification error informed by the proxy, like the Google X-Client-Cert-Error. Empty if none.
+	Error string
+}
+
+//identityFromCertificate creates the identity of a (not yet verified) client certificate.
+func identityFromCertificate(cert *x509.Certificate) *ClientIdentity {
+	var uris []string
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+	hash := sha256.Sum256(cert.Raw)
+	return &ClientIdentity{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SubjectName:  cert.Subject,
+		IssuerName:   cert.Issuer,
+		SerialNumber: fmt.Sprintf("%X", cert.SerialNumber),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		URIs:         uris,
+		DNSNames:     cert.DNSNames,
+		Hash:         hex.EncodeToString(hash[:]),
+	}
+}
+
+//SPIFFEID returns the first URI with the spiffe scheme, or an empty string if there is none.
+func (id *ClientIdentity) SPIFFEID() string {
+	for _, u := range id.URIs {
+		if strings.HasPrefix(strings.ToLower(u), "spiffe://") {
+			return u
+		}
+	}
+	return ""
+}
+
+//Identity returns the client identity of a request returned by NewProxiedRequest, or nil if there is no client certificate
+//or r was not processed by NewProxiedRequest.
+func Identity(r *http.Request) *ClientIdentity {
+	f := forwardedFrom(r)
+	if f == nil || f.identity == nil {
+		return nil
+	}
+	id := *f.identity
+	id.URIs = append([]string(nil), id.URIs...)
+	id.DNSNames = append([]string(nil), id.DNSNames...)
+	id.By = append([]string(nil), id.By...)
+	return &id
+}
@@ -0,0 +1,125 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+//NginxRealIP is the Preset that reproduces the client address of the nginx realip module (ngx_http_realip_module), so the
+//addresses match the ones of an nginx configured with:
+//
+//	set_real_ip_from  <From>;
+//	real_ip_header    <Header>;
+//	real_ip_recursive <Recursive>;
+//
+//If the peer is not in From, the request is kept as it came, like nginx does. Otherwise, the client is the last address of
+//Header (a list separated by commas or spaces) or, if Recursive, the last one not in From, or the first one if all of them
+//are. An entry that is not an IP address, with optional port, stops the search, keeping the last address found, and an
+//absent header keeps the peer. When the peer is in From, the optional X-Forwarded-Proto, X-Forwarded-Host and
+//X-Forwarded-Port are used as well.
+//
+//TrustedProxies is nil, as set_real_ip_from is checked by Extract: nginx serves the other peers with their own address,
+//and so does the preset, unless Config.TrustedProxies is set to reject them.
+type NginxRealIP struct {
+	//From are the trusted addresses, set_real_ip_from.
+	From *PrefixSet
+	//Header is the real_ip_header. If empty, "X-Forwarded-For" is used.
+	Header string
+	//Recursive is real_ip_recursive.
+	Recursive bool
+	//ProxyProtocol, if set, makes the source the PROXY protocol header (real_ip_header proxy_protocol) instead of Header.
+	//It returns the source address of the PROXY protocol header of the request connection, as stored by the listener
+	//(like with http.Server.ConnContext), and false if there is none.
+	ProxyProtocol func(r *http.Request) (netip.AddrPort, bool)
+}
+
+//Name returns "nginx".
+func (NginxRealIP) Name() string {
+	return "nginx"
+}
+
+//Headers returns the real_ip_header and the X-Forwarded-* headers.
+func (p NginxRealIP) Headers() []string {
+	if p.Header == "" {
+		return forwardingHeaders
+	}
+	return append([]string{p.Header}, forwardingHeaders...)
+}
+
+//TrustedProxies returns nil, as the peer is checked against From by Extract.
+func (NginxRealIP) TrustedProxies() *PrefixSet {
+	return nil
+}
+
+//Extract selects the client like the nginx realip module. No header is required.
+func (p NginxRealIP) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+	peer, err := ParseHop(r.RemoteAddr)
+	if err != nil || !peer.HasAddr() || !p.From.Contains(peer.Addr) {
+		return fw, nil
+	}
+
+	//The PROXY protocol source replaces the peer, with its port.
+	if p.ProxyProtocol != nil {
+		if src, ok := p.ProxyProtocol(r); ok {
+			fw.Client = Hop{Kind: HopIPPort, Addr: src.Addr().Unmap(), Port: src.Port()}
+		}
+	} else {
+		header := p.Header
+		if header == "" {
+			header = "X-Forwarded-For"
+		}
+		list, err := c.ListHeader(r.Header, header)
+		if err != nil {
+			return nil, err
+		}
+		fw.For, fw.Client = p.realIP(list)
+	}
+
+	if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Host, err = c.Header(r.Header, "X-Forwarded-Host"); err != nil {
+		return nil, err
+	}
+	if fw.Port, err = c.Header(r.Header, "X-Forwarded-Port"); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+//realIP walks the list from the right like ngx_http_get_forwarded_addr, returning the addresses walked (from the left) and
+//the client, or an invalid hop if the peer is kept. It is only called when the peer is in From.
+func (p NginxRealIP) realIP(list string) ([]Hop, Hop) {
+	entries := strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' })
+	var walked []Hop
+	client := Hop{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		h, err := ParseHop(entries[i])
+		if err != nil || (h.Kind != HopIP && h.Kind != HopIPPort) || strings.ContainsAny(entries[i], `"_`) {
+			break
+		}
+		walked = append([]Hop{h}, walked...)
+		client = h
+		if !p.Recursive || !p.From.Contains(h.Addr) {
+			break
+		}
+	}
+	return walked, client
+}
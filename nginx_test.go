@@ -0,0 +1,127 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestNginxRealIP(t *testing.T) {
+	//The configuration of the nginx documentation:
+	//
+	//	set_real_ip_from  192.168.1.0/24;
+	//	set_real_ip_from  192.168.2.1;
+	//	set_real_ip_from  2001:0db8::/32;
+	from, err := proxyheaders.ParsePrefixSet("192.168.1.0/24", "192.168.2.1", "2001:0db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		peer      string
+		header    string
+		value     string
+		recursive bool
+		want      string
+	}{
+		//Peers not in set_real_ip_from are kept.
+		{"203.0.113.1:1234", "X-Forwarded-For", "198.51.100.1", false, "203.0.113.1:1234"},
+		{"203.0.113.1:1234", "X-Forwarded-For", "198.51.100.1", true, "203.0.113.1:1234"},
+		//Non recursive: the last address.
+		{"192.168.1.10:1234", "X-Forwarded-For", "198.51.100.1", false, "198.51.100.1"},
+		{"192.168.1.10:1234", "X-Forwarded-For", "198.51.100.1, 192.168.2.1", false, "192.168.2.1"},
+		{"[2001:db8::1]:1234", "X-Forwarded-For", "198.51.100.1, 192.168.1.20", false, "192.168.1.20"},
+		//Recursive: the last address not trusted...
+		{"192.168.1.10:1234", "X-Forwarded-For", "198.51.100.1, 192.168.2.1", true, "198.51.100.1"},
+		{"192.168.1.10:1234", "X-Forwarded-For", "10.0.0.1, 198.51.100.1, 192.168.1.20, 2001:db8::2", true, "198.51.100.1"},
+		//...or the first when all of them are.
+		{"192.168.1.10:1234", "X-Forwarded-For", "192.168.1.30, 192.168.2.1", true, "192.168.1.30"},
+		//Spaces and commas are separators.
+		{"192.168.1.10:1234", "X-Forwarded-For", "198.51.100.1 192.168.2.1,,", true, "198.51.100.1"},
+		//Ports are kept.
+		{"192.168.1.10:1234", "X-Forwarded-For", "198.51.100.1:5678", false, "198.51.100.1:5678"},
+		{"192.168.1.10:1234", "X-Forwarded-For", "[2001:db8:1::1]:5678", false, "[2001:db8:1::1]:5678"},
+		//Invalid entries stop the search, keeping the last address found.
+		{"192.168.1.10:1234", "X-Forwarded-For", "unknown", false, "192.168.1.10:1234"},
+		{"192.168.1.10:1234", "X-Forwarded-For", "198.51.100.1, unknown, 192.168.2.1", true, "192.168.2.1"},
+		{"192.168.1.10:1234", "X-Forwarded-For", "198.51.100.1, _hidden", true, "192.168.1.10:1234"},
+		//Absent headers keep the peer.
+		{"192.168.1.10:1234", "X-Forwarded-For", "", true, "192.168.1.10:1234"},
+		//Other headers, like X-Real-IP, follow the same algorithm.
+		{"192.168.1.10:1234", "X-Real-IP", "198.51.100.1", false, "198.51.100.1"},
+		{"192.168.1.10:1234", "X-Real-IP", "198.51.100.1, 192.168.2.1", true, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+		req.RemoteAddr = tt.peer
+		if tt.value != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		c := &proxyheaders.Config{Preset: proxyheaders.NginxRealIP{From: from, Header: tt.header, Recursive: tt.recursive}}
+		pr, err := c.NewProxiedRequest(req)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("%+v: want=%v, got=%v", tt, want, got)
+		}
+		if want, got := tt.want, pr.RemoteAddr; want != got {
+			t.Fatalf("%+v: want=%s, got=%s", tt, want, got)
+		}
+	}
+}
+
+func TestNginxRealIP_proxyProtocol(t *testing.T) {
+	from, err := proxyheaders.ParsePrefixSet("192.168.1.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &proxyheaders.Config{Preset: proxyheaders.NginxRealIP{
+		From: from,
+		ProxyProtocol: func(r *http.Request) (netip.AddrPort, bool) {
+			return netip.MustParseAddrPort("198.51.100.1:5678"), true
+		},
+	}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/", nil)
+	req.RemoteAddr = "192.168.1.10:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "198.51.100.1:5678", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "https", pr.URL.Scheme; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//Untrusted peers keep their address and their forwarding headers are ignored.
+	req.RemoteAddr = "203.0.113.9:1234"
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "203.0.113.9:1234", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "http", pr.URL.Scheme; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+}
@@ -0,0 +1,397 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+//ErrPlatformClientIPMustBeValid is returned when the client address header of a platform (like Fly-Client-IP) is not an
+//IP address.
+var ErrPlatformClientIPMustBeValid = errors.New("proxyheaders: platform client IP header must be an IP address")
+
+//ErrMustHavePlatformClientIP is returned when the client address header a platform always sets (like Fly-Client-IP) is
+//absent. The actual error returned wraps this one, with the header name.
+var ErrMustHavePlatformClientIP = errors.New("proxyheaders: must have the platform client IP header")
+
+//Well-known names of Forwarded.Attributes set by the platform presets.
+const (
+	//AttrRegion is the region of the platform that received the request, like the Fly.io Fly-Region.
+	AttrRegion = "region"
+	//AttrRequestStart is the time the platform received the request, in milliseconds since the Unix epoch, like the Heroku
+	//X-Request-Start.
+	AttrRequestStart = "request-start"
+)
+
+//The platform presets trust every peer (their TrustedProxies is nil), as only the platform proxy can reach the application.
+//Config.TrustedProxies can still restrict them. The client is always selected as the platform documents, never using the
+//trusted proxies.
+
+//Heroku is the Preset for applications running in Heroku.
+//
+//The router appends the address it received the request from to X-Forwarded-For, so the client is the rightmost entry.
+//The protocol and the port come from the last entry of X-Forwarded-Proto and X-Forwarded-Port. The host is the Host header,
+//the herokuapp.com or custom domain the router matched the app by. The request ID (X-Request-Id) and the time the router received the request
+//(X-Request-Start) are available with Attribute, as AttrRequestID and AttrRequestStart.
+type Heroku struct{}
+
+//Name returns "heroku".
+func (Heroku) Name() string {
+	return "heroku"
+}
+
+//Headers returns X-Request-Start and the X-Forwarded-* headers.
+func (Heroku) Headers() []string {
+	return append([]string{"X-Request-Start"}, forwardingHeaders...)
+}
+
+//TrustedProxies returns nil, trusting the Heroku router.
+func (Heroku) TrustedProxies() *PrefixSet {
+	return nil
+}
+
+//Extract reads the Heroku headers. X-Forwarded-For and X-Forwarded-Proto are required.
+func (Heroku) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw, err := extractRightmostClient(c, r)
+	if err != nil {
+		return nil, err
+	}
+	if fw.Proto, err = c.ListHeader(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Proto = lastListEntry(fw.Proto); fw.Proto == "" {
+		return nil, ErrMustHaveXForwardedProto
+	}
+	if fw.Port, err = c.ListHeader(r.Header, "X-Forwarded-Port"); err != nil {
+		return nil, err
+	}
+	fw.Port = lastListEntry(fw.Port)
+	if err := setAttributes(c, r, fw, map[string]string{"X-Request-Id": AttrRequestID, "X-Request-Start": AttrRequestStart}); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+//FlyIO is the Preset for applications running in Fly.io.
+//
+//The client address comes from Fly-Client-IP, the protocol from X-Forwarded-Proto and the port from Fly-Forwarded-Port or,
+//if absent, X-Forwarded-Port. The host is the Host header, the fly.dev or certificate hostname the client asked for. The
+//edge region (Fly-Region) and the request ID (Fly-Request-Id) are available with Attribute, as AttrRegion and AttrRequestID.
+type FlyIO struct{}
+
+//Name returns "fly".
+func (FlyIO) Name() string {
+	return "fly"
+}
+
+//Headers returns the Fly.io headers and the X-Forwarded-* ones.
+func (FlyIO) Headers() []string {
+	return append([]string{"Fly-Client-IP", "Fly-Forwarded-Port", "Fly-Region"}, forwardingHeaders...)
+}
+
+//TrustedProxies returns nil, trusting the Fly.io proxy.
+func (FlyIO) TrustedProxies() *PrefixSet {
+	return nil
+}
+
+//Extract reads the Fly.io headers. Fly-Client-IP and X-Forwarded-Proto are required.
+func (FlyIO) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw, err := extractClientHeader(c, r, "Fly-Client-IP", true)
+	if err != nil {
+		return nil, err
+	}
+	if err := extractProtoPort(c, r, fw); err != nil {
+		return nil, err
+	}
+	port, err := c.Header(r.Header, "Fly-Forwarded-Port")
+	if err != nil {
+		return nil, err
+	}
+	if port != "" {
+		fw.Port = port
+	}
+	if err := setAttributes(c, r, fw, map[string]string{"Fly-Region": AttrRegion, "Fly-Request-Id": AttrRequestID}); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+//Render is the Preset for applications running in Render.
+//
+//The client address comes from True-Client-IP, set by the Render edge, or if absent, the rightmost X-Forwarded-For entry.
+//The protocol comes from X-Forwarded-Proto. The host is the Host header, the onrender.com or custom domain of the service.
+//The request ID (Rndr-Id) is available with Attribute, as AttrRequestID.
+type Render struct{}
+
+//Name returns "render".
+func (Render) Name() string {
+	return "render"
+}
+
+//Headers returns True-Client-IP and the X-Forwarded-* headers.
+func (Render) Headers() []string {
+	return append([]string{"True-Client-IP"}, forwardingHeaders...)
+}
+
+//TrustedProxies returns nil, trusting the Render proxy.
+func (Render) TrustedProxies() *PrefixSet {
+	return nil
+}
+
+//Extract reads the Render headers. True-Client-IP or X-Forwarded-For, and X-Forwarded-Proto, are required.
+func (Render) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw, err := extractClientHeader(c, r, "True-Client-IP", false)
+	if err != nil {
+		return nil, err
+	}
+	if fw.Client.Kind == HopInvalid {
+		if len(fw.For) == 0 {
+			return nil, ErrMustHaveXForwardedFor
+		}
+		fw.Client = fw.For[len(fw.For)-1]
+	}
+	if err := extractProtoPort(c, r, fw); err != nil {
+		return nil, err
+	}
+	if err := setAttributes(c, r, fw, map[string]string{"Rndr-Id": AttrRequestID}); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+//Vercel is the Preset for applications running in Vercel.
+//
+//The client address comes from X-Vercel-Forwarded-For, that unlike X-Forwarded-For cannot be set by the client, or if absent
+//from X-Real-IP. The host comes from X-Forwarded-Host and the protocol from X-Forwarded-Proto. The request ID (X-Vercel-Id)
+//and the geolocation (X-Vercel-IP-Country, -Country-Region, -City, -Latitude and -Longitude) are available with Attribute,
+//as AttrRequestID, AttrCountry, AttrSubdivision, AttrCity and AttrLatLong.
+type Vercel struct{}
+
+//Name returns "vercel".
+func (Vercel) Name() string {
+	return "vercel"
+}
+
+//Headers returns the Vercel client address headers and the X-Forwarded-* ones.
+func (Vercel) Headers() []string {
+	return append([]string{"X-Vercel-Forwarded-For", "X-Real-IP"}, forwardingHeaders...)
+}
+
+//TrustedProxies returns nil, trusting the Vercel proxy.
+func (Vercel) TrustedProxies() *PrefixSet {
+	return nil
+}
+
+//Extract reads the Vercel headers. X-Vercel-Forwarded-For or X-Real-IP, and X-Forwarded-Proto, are required.
+func (Vercel) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+	vff, err := c.ListHeader(r.Header, "X-Vercel-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if vff == "" {
+		if vff, err = c.Header(r.Header, "X-Real-IP"); err != nil {
+			return nil, err
+		}
+	}
+	if vff == "" {
+		return nil, ErrMustHaveXForwardedFor
+	}
+	if fw.For, err = c.ParseHops(vff); err != nil {
+		return nil, err
+	}
+	if len(fw.For) == 0 {
+		return nil, ErrMustHaveXForwardedFor
+	}
+	fw.Client = fw.For[0]
+	if fw.Host, err = c.Header(r.Header, "X-Forwarded-Host"); err != nil {
+		return nil, err
+	}
+	if err := extractProtoPort(c, r, fw); err != nil {
+		return nil, err
+	}
+	if err := setAttributes(c, r, fw, map[string]string{
+		"X-Vercel-Id":                AttrRequestID,
+		"X-Vercel-IP-Country":        AttrCountry,
+		"X-Vercel-IP-Country-Region": AttrSubdivision,
+	}); err != nil {
+		return nil, err
+	}
+	city, err := c.Header(r.Header, "X-Vercel-IP-City")
+	if err != nil {
+		return nil, err
+	}
+	if city, err = url.PathUnescape(city); err == nil {
+		fw.setAttribute(AttrCity, city)
+	}
+	lat, err := c.Header(r.Header, "X-Vercel-IP-Latitude")
+	if err != nil {
+		return nil, err
+	}
+	long, err := c.Header(r.Header, "X-Vercel-IP-Longitude")
+	if err != nil {
+		return nil, err
+	}
+	if lat != "" && long != "" {
+		fw.setAttribute(AttrLatLong, lat+","+long)
+	}
+	return fw, nil
+}
+
+//CloudRun is the Preset for applications running in Google Cloud Run, without a load balancer (see Google for it).
+//
+//The Google Front End appends the address it received the request from to X-Forwarded-For, so the client is the rightmost
+//entry. The protocol comes from X-Forwarded-Proto. The host is the Host header, the run.app or mapped domain of the service.
+//The trace context (X-Cloud-Trace-Context) is available with Attribute, as AttrTraceID, and left in the request, as Cloud
+//Logging groups the logs written with it under the request.
+type CloudRun struct{}
+
+//Name returns "cloud-run".
+func (CloudRun) Name() string {
+	return "cloud-run"
+}
+
+//Headers returns the X-Forwarded-* headers.
+func (CloudRun) Headers() []string {
+	return forwardingHeaders
+}
+
+//TrustedProxies returns nil, trusting the Google Front End.
+func (CloudRun) TrustedProxies() *PrefixSet {
+	return nil
+}
+
+//Extract reads the Cloud Run headers. X-Forwarded-For and X-Forwarded-Proto are required.
+func (CloudRun) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw, err := extractRightmostClient(c, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := extractProtoPort(c, r, fw); err != nil {
+		return nil, err
+	}
+	if err := setAttributes(c, r, fw, map[string]string{"X-Cloud-Trace-Context": AttrTraceID}); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+//platformEnvironment are the environment variables set by each platform, in the order they are detected.
+var platformEnvironment = []struct {
+	variable string
+	preset   Preset
+}{
+	{"DYNO", Heroku{}},
+	{"FLY_APP_NAME", FlyIO{}},
+	{"RENDER", Render{}},
+	{"VERCEL", Vercel{}},
+	{"K_SERVICE", CloudRun{}},
+}
+
+//DetectPlatform returns the Preset of the platform the program is running in, detected with the environment variables the
+//platforms set: DYNO (Heroku), FLY_APP_NAME (Fly.io), RENDER (Render), VERCEL (Vercel) and K_SERVICE (Cloud Run).
+//It returns nil if none is set, so it can be assigned to Config.Preset directly, falling back to XForwarded.
+func DetectPlatform() Preset {
+	for _, p := range platformEnvironment {
+		if v, ok := os.LookupEnv(p.variable); ok && v != "" {
+			return p.preset
+		}
+	}
+	return nil
+}
+
+//extractRightmostClient reads the required X-Forwarded-For, selecting the rightmost entry as the client.
+func extractRightmostClient(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff == "" {
+		return nil, ErrMustHaveXForwardedFor
+	}
+	if fw.For, err = c.ParseHops(xff); err != nil {
+		return nil, err
+	}
+	if len(fw.For) == 0 {
+		return nil, ErrMustHaveXForwardedFor
+	}
+	fw.Client = fw.For[len(fw.For)-1]
+	return fw, nil
+}
+
+//extractClientHeader reads the optional X-Forwarded-For and the client address from header, that may be required.
+func extractClientHeader(c *Config, r *http.Request, header string, required bool) (*Forwarded, error) {
+	fw := &Forwarded{}
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff != "" {
+		if fw.For, err = c.ParseHops(xff); err != nil {
+			return nil, err
+		}
+	}
+	cip, err := c.Header(r.Header, header)
+	if err != nil {
+		return nil, err
+	}
+	if cip == "" {
+		if required {
+			return nil, fmt.Errorf("%w: %s", ErrMustHavePlatformClientIP, header)
+		}
+		return fw, nil
+	}
+	if fw.Client, err = ParseHop(cip); err != nil || fw.Client.Kind != HopIP {
+		return nil, ErrPlatformClientIPMustBeValid
+	}
+	return fw, nil
+}
+
+//extractProtoPort reads the required X-Forwarded-Proto and the optional X-Forwarded-Port.
+func extractProtoPort(c *Config, r *http.Request, fw *Forwarded) error {
+	var err error
+	if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return err
+	}
+	if fw.Proto == "" {
+		return ErrMustHaveXForwardedProto
+	}
+	fw.Port, err = c.Header(r.Header, "X-Forwarded-Port")
+	return err
+}
+
+//setAttributes sets the attributes from the headers, mapped from the header name to the attribute name.
+func setAttributes(c *Config, r *http.Request, fw *Forwarded, headers map[string]string) error {
+	for h, name := range headers {
+		v, err := c.Header(r.Header, h)
+		if err != nil {
+			return err
+		}
+		fw.setAttribute(name, v)
+	}
+	return nil
+}
+
+//lastListEntry returns the last entry of a comma separated list, trimmed.
+func lastListEntry(list string) string {
+	return strings.TrimSpace(list[strings.LastIndex(list, ",")+1:])
+}
@@ -0,0 +1,148 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestPlatforms(t *testing.T) {
+	tests := []struct {
+		preset  proxyheaders.Preset
+		headers map[string]string
+		//Expected values.
+		remoteAddr string
+		host       string
+		scheme     string
+		attr       string
+		attrValue  string
+	}{
+		{
+			preset: proxyheaders.Heroku{},
+			headers: map[string]string{
+				"X-Forwarded-For":   "192.0.2.1, 203.0.113.7",
+				"X-Forwarded-Proto": "http, https",
+				"X-Forwarded-Port":  "80, 443",
+				"X-Request-Start":   "1700000000000",
+			},
+			remoteAddr: "203.0.113.7", host: "app.example.com", scheme: "https",
+			attr: proxyheaders.AttrRequestStart, attrValue: "1700000000000",
+		},
+		{
+			preset: proxyheaders.FlyIO{},
+			headers: map[string]string{
+				"Fly-Client-IP":      "203.0.113.7",
+				"X-Forwarded-For":    "192.0.2.1, 203.0.113.7",
+				"X-Forwarded-Proto":  "https",
+				"X-Forwarded-Port":   "443",
+				"Fly-Forwarded-Port": "8443",
+				"Fly-Region":         "gru",
+			},
+			remoteAddr: "203.0.113.7", host: "app.example.com:8443", scheme: "https",
+			attr: proxyheaders.AttrRegion, attrValue: "gru",
+		},
+		{
+			preset: proxyheaders.Render{},
+			headers: map[string]string{
+				"True-Client-IP":    "203.0.113.7",
+				"X-Forwarded-For":   "203.0.113.7, 172.71.1.1",
+				"X-Forwarded-Proto": "https",
+				"Rndr-Id":           "a1b2c3",
+			},
+			remoteAddr: "203.0.113.7", host: "app.example.com", scheme: "https",
+			attr: proxyheaders.AttrRequestID, attrValue: "a1b2c3",
+		},
+		{
+			preset: proxyheaders.Vercel{},
+			headers: map[string]string{
+				"X-Vercel-Forwarded-For": "203.0.113.7",
+				"X-Forwarded-For":        "192.0.2.1",
+				"X-Forwarded-Host":       "www.example.com",
+				"X-Forwarded-Proto":      "https",
+				"X-Vercel-IP-City":       "S%C3%A3o%20Paulo",
+			},
+			remoteAddr: "203.0.113.7", host: "www.example.com", scheme: "https",
+			attr: proxyheaders.AttrCity, attrValue: "São Paulo",
+		},
+		{
+			preset: proxyheaders.CloudRun{},
+			headers: map[string]string{
+				"X-Forwarded-For":       "192.0.2.1, 203.0.113.7",
+				"X-Forwarded-Proto":     "https",
+				"X-Cloud-Trace-Context": "105445aa7843bc8bf206b12000100000/1;o=1",
+			},
+			remoteAddr: "203.0.113.7", host: "app.example.com", scheme: "https",
+			attr: proxyheaders.AttrTraceID, attrValue: "105445aa7843bc8bf206b12000100000/1;o=1",
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+		req.RemoteAddr = "169.254.1.1:40000"
+		for h, v := range tt.headers {
+			req.Header.Set(h, v)
+		}
+		c := &proxyheaders.Config{Preset: tt.preset}
+		pr, err := c.NewProxiedRequest(req)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("%s: want=%v, got=%v", tt.preset.Name(), want, got)
+		}
+		if want, got := tt.remoteAddr, pr.RemoteAddr; want != got {
+			t.Fatalf("%s: want=%s, got=%s", tt.preset.Name(), want, got)
+		}
+		if want, got := tt.host, pr.Host; want != got {
+			t.Fatalf("%s: want=%s, got=%s", tt.preset.Name(), want, got)
+		}
+		if want, got := tt.scheme, pr.URL.Scheme; want != got {
+			t.Fatalf("%s: want=%s, got=%s", tt.preset.Name(), want, got)
+		}
+		if want, got := tt.attrValue, proxyheaders.Attribute(pr, tt.attr); want != got {
+			t.Fatalf("%s: want=%s, got=%s", tt.preset.Name(), want, got)
+		}
+	}
+}
+
+func TestFlyIO_failMustHaveClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	_, err := (&proxyheaders.Config{Preset: proxyheaders.FlyIO{}}).NewProxiedRequest(req)
+	if !errors.Is(err, proxyheaders.ErrMustHavePlatformClientIP) || !strings.Contains(err.Error(), "Fly-Client-IP") {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrMustHavePlatformClientIP, err)
+	}
+}
+
+func TestDetectPlatform(t *testing.T) {
+	for _, v := range []string{"DYNO", "FLY_APP_NAME", "RENDER", "VERCEL", "K_SERVICE"} {
+		t.Setenv(v, "")
+	}
+	if want, got := proxyheaders.Preset(nil), proxyheaders.DetectPlatform(); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	t.Setenv("K_SERVICE", "hello")
+	if want, got := proxyheaders.Preset(proxyheaders.CloudRun{}), proxyheaders.DetectPlatform(); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	t.Setenv("FLY_APP_NAME", "hello")
+	if want, got := proxyheaders.Preset(proxyheaders.FlyIO{}), proxyheaders.DetectPlatform(); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
@@ -0,0 +1,276 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//ErrPresetMustBeKnown is returned by PresetByName when there is no preset with the name. The actual error returned wraps
+//this one, with the name.
+var ErrPresetMustBeKnown = errors.New("proxyheaders: preset must be a known preset name")
+
+//Well-known names of Forwarded.Attributes, retrievable with Attribute.
+const (
+	//AttrCountry is the ISO 3166-1 alpha-2 country code of the client, as geolocated by the proxy.
+	AttrCountry = "country"
+	//AttrRayID is the Cloudflare request identifier (CF-Ray).
+	AttrRayID = "ray-id"
+	//AttrTraceID is the request tracing identifier, like the AWS X-Amzn-Trace-Id.
+	AttrTraceID = "trace-id"
+)
+
+//Forwarded are the values a proxy asserts about the original request, extracted from its headers by a Preset.
+//
+//Config.NewProxiedRequest validates them and embeds them in the resolved request. Empty values are not asserted by the proxy,
+//and the values of the request as received are kept.
+type Forwarded struct {
+	//For are the hops the request passed through, from the client (first) to the nearest proxy (last).
+	For []Hop
+	//Client is the client hop, when the proxy informs it apart from For (like CF-Connecting-IP). If its Kind is HopInvalid,
+	//the client is selected from For, using the trusted proxies.
+	Client Hop
+	//Host is the host the client asked for, with optional port.
+	Host string
+	//Proto is the protocol the client used: "http", "https", "ws" or "wss", case-insensitive.
+	Proto string
+	//Port is the port the client used.
+	Port string
+	//Prefix is the path prefix removed by the proxy.
+	Prefix string
+	//TLS are the facts of the TLS connection terminated by the proxy, for secure protocols.
+	TLS ForwardedTLS
+	//Certificates are the client certificate (first) and its intermediates.
+	Certificates []*x509.Certificate
+	//Identity is the client identity, when the proxy informs it in headers of its own. If nil, it is read from the first
+	//certificate in Certificates.
+	Identity *ClientIdentity
+	//Attributes are values specific to the proxy, like the client country. See the Attr* constants.
+	Attributes map[string]string
+	//Header are headers added to the resolved request, after the forwarding headers are removed.
+	Header http.Header
+}
+
+//ForwardedTLS are the facts of a TLS connection terminated by a proxy. Zero values are unknown.
+type ForwardedTLS struct {
+	//Version is the TLS version, like tls.VersionTLS13.
+	Version uint16
+	//CipherSuite is the cipher suite, like tls.TLS_AES_128_GCM_SHA256.
+	CipherSuite uint16
+	//ServerName is the name sent by the client in the SNI extension.
+	ServerName string
+	//NegotiatedProtocol is the protocol negotiated with ALPN, like "h2".
+	NegotiatedProtocol string
+}
+
+//setAttribute sets an attribute, creating the map if needed. Empty values are ignored.
+func (fw *Forwarded) setAttribute(name, value string) {
+	if value == "" {
+		return
+	}
+	if fw.Attributes == nil {
+		fw.Attributes = make(map[string]string)
+	}
+	fw.Attributes[name] = value
+}
+
+//Preset adapts Config.NewProxiedRequest to the headers of a specific proxy, CDN or platform.
+type Preset interface {
+	//Name identifies the preset, like "cloudflare".
+	Name() string
+	//Extract reads the forwarded values from the headers of r, reading each header with Config.Header or Config.ListHeader
+	//so the duplicate policy is respected. It returns an error if a required header is absent or malformed.
+	Extract(c *Config, r *http.Request) (*Forwarded, error)
+	//Headers are the headers consumed by Extract, removed from the resolved request.
+	Headers() []string
+	//TrustedProxies are the published addresses of the proxy, trusted in addition to Config.TrustedProxies. It can be nil.
+	TrustedProxies() *PrefixSet
+}
+
+//presets are the presets of this package, with their zero configuration.
+var presets = []Preset{
+	XForwarded{}, Cloudflare{}, AWSALB{}, Envoy{}, HAProxy{}, Azure{}, Google{}, Fastly{}, Akamai{},
+	Heroku{}, FlyIO{}, Render{}, Vercel{}, CloudRun{}, NginxRealIP{}, ApacheRemoteIP{},
+}
+
+//PresetByName returns the preset of this package with the name (like "cloudflare" or "heroku"), case-insensitive, with its
+//zero configuration. It returns an error wrapping ErrPresetMustBeKnown if there is none.
+//
+//Some presets need options to be safe, like the Azure FrontDoorID: Config.Validate rejects the configurations without them.
+func PresetByName(name string) (Preset, error) {
+	for _, p := range presets {
+		if strings.EqualFold(p.Name(), strings.TrimSpace(name)) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrPresetMustBeKnown, name)
+}
+
+//XForwarded is the default Preset, for the de facto standard X-Forwarded-* headers. See NewProxiedRequest for the headers.
+type XForwarded struct{}
+
+//Name returns "x-forwarded".
+func (XForwarded) Name() string {
+	return "x-forwarded"
+}
+
+//Headers returns the X-Forwarded-* headers and the TLS facts headers.
+func (XForwarded) Headers() []string {
+	return forwardingHeaders
+}
+
+//TrustedProxies returns nil, there are no well-known addresses.
+func (XForwarded) TrustedProxies() *PrefixSet {
+	return nil
+}
+
+//Extract reads the X-Forwarded-* headers. X-Forwarded-Host, X-Forwarded-For and X-Forwarded-Proto are required.
+func (XForwarded) Extract(c *Config, r *http.Request) (*Forwarded, error) {
+	fw := &Forwarded{}
+	var err error
+
+	//Extract and test the expected X-Forwarded-* headers, returning errors if any of them are missed.
+	if fw.Host, err = c.Header(r.Header, "X-Forwarded-Host"); err != nil {
+		return nil, err
+	}
+	if fw.Host == "" {
+		return nil, ErrMustHaveXForwardedHost
+	}
+	xff, err := c.ListHeader(r.Header, "X-Forwarded-For")
+	if err != nil {
+		return nil, err
+	}
+	if xff == "" {
+		return nil, ErrMustHaveXForwardedFor
+	}
+	if fw.For, err = c.ParseHops(xff); err != nil {
+		return nil, err
+	}
+	if fw.Proto, err = c.Header(r.Header, "X-Forwarded-Proto"); err != nil {
+		return nil, err
+	}
+	if fw.Proto == "" {
+		return nil, ErrMustHaveXForwardedProto
+	}
+
+	//Extract the optional ones.
+	if fw.Port, err = c.Header(r.Header, "X-Forwarded-Port"); err != nil {
+		return nil, err
+	}
+	if fw.Prefix, err = c.Header(r.Header, "X-Forwarded-Prefix"); err != nil {
+		return nil, err
+	}
+	if fw.TLS, err = c.extractTLSHeaders(r.Header); err != nil {
+		return nil, err
+	}
+	xfcc, err := c.Header(r.Header, "X-Forwarded-Client-Cert")
+	if err != nil {
+		return nil, err
+	}
+	if fw.Certificates, err = parsePEMCertificates(xfcc); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+//CertFormat is the encoding of the client certificates in a header.
+type CertFormat int
+
+const (
+	//CertFormatPEM are PEM blocks, the client certificate first, like in X-Forwarded-Client-Cert.
+	CertFormatPEM CertFormat = iota
+	//CertFormatURLEncodedPEM are URL encoded PEM blocks, like the nginx $ssl_client_escaped_cert or the AWS ALB
+	//X-Amzn-Mtls-Clientcert.
+	CertFormatURLEncodedPEM
+	//CertFormatBase64DER is a base64 DER certificate, like the HAProxy ssl_c_der or the Azure X-ARR-ClientCert.
+	CertFormatBase64DER
+)
+
+//String returns the format name.
+func (f CertFormat) String() string {
+	switch f {
+	case CertFormatPEM:
+		return "pem"
+	case CertFormatURLEncodedPEM:
+		return "url-pem"
+	case CertFormatBase64DER:
+		return "base64-der"
+	}
+	return fmt.Sprintf("CertFormat(%d)", int(f))
+}
+
+//parseCertificates decodes the certificates of s in the format, returning errInvalid if they are malformed. An empty s
+//results in no certificates.
+func parseCertificates(s string, format CertFormat, errInvalid error) ([]*x509.Certificate, error) {
+	if s == "" {
+		return nil, nil
+	}
+	switch format {
+	case CertFormatURLEncodedPEM:
+		return parseURLEncodedPEMCertificates(s, errInvalid)
+	case CertFormatBase64DER:
+		cert, err := parseBase64DERCertificate(s, errInvalid)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{cert}, nil
+	}
+	certs, err := parsePEMCertificates(s)
+	if err != nil || len(certs) == 0 {
+		return nil, errInvalid
+	}
+	return certs, nil
+}
+
+//parsePEMCertificates decodes the certificates in PEM blocks. An empty s results in no certificates.
+func parsePEMCertificates(s string) ([]*x509.Certificate, error) {
+	var block *pem.Block
+	pemRemainder := []byte(s)
+	var certs []*x509.Certificate
+	for {
+		block, pemRemainder = pem.Decode(pemRemainder)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, ErrXForwardedClientCertMustBeValid
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+//parseBase64DERCertificate decodes a base64 DER certificate, with or without padding, returning errInvalid if it is malformed.
+func parseBase64DERCertificate(s string, errInvalid error) (*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		if der, err = base64.RawStdEncoding.DecodeString(s); err != nil {
+			return nil, errInvalid
+		}
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errInvalid
+	}
+	return cert, nil
+}
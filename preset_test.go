@@ -0,0 +1,51 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"errors"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestPresetByName(t *testing.T) {
+	for _, name := range []string{
+		"x-forwarded", "cloudflare", "aws-alb", "envoy", "haproxy", "azure", "google", "fastly", "akamai",
+		"heroku", "fly", "render", "vercel", "cloud-run", "nginx", "apache",
+	} {
+		p, err := proxyheaders.PresetByName(name)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("name=%s: want=%v, got=%v", name, want, got)
+		}
+		if want, got := name, p.Name(); want != got {
+			t.Fatalf("want=%s, got=%s", want, got)
+		}
+	}
+
+	p, err := proxyheaders.PresetByName(" Heroku ")
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := proxyheaders.Preset(proxyheaders.Heroku{}), p; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	_, err = proxyheaders.PresetByName("traefik")
+	if want, got := true, errors.Is(err, proxyheaders.ErrPresetMustBeKnown); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+}
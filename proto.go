@@ -0,0 +1,52 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"fmt"
+	"strings"
+)
+
+//ProtoError is returned when the X-Forwarded-Proto header has an unknown value.
+//
+//It matches ErrXForwardedProtoMustBeValid using errors.Is.
+type ProtoError struct {
+	//Proto is the offending value, as received.
+	Proto string
+}
+
+//Error implements the error interface.
+func (e *ProtoError) Error() string {
+	return fmt.Sprintf("proxyheaders: unknown X-Forwarded-Proto %q, must be http, https, ws or wss", e.Proto)
+}
+
+//Is makes errors.Is(err, ErrXForwardedProtoMustBeValid) true for any *ProtoError.
+func (e *ProtoError) Is(target error) bool {
+	return target == ErrXForwardedProtoMustBeValid
+}
+
+//parseProto validates a forwarded protocol case-insensitively, returning the canonical (lowercase) scheme and
+//if the protocol runs over TLS.
+func parseProto(proto string) (scheme string, secure bool, err error) {
+	scheme = strings.ToLower(strings.TrimSpace(proto))
+	switch scheme {
+	case "http", "ws":
+		return scheme, false, nil
+	case "https", "wss":
+		return scheme, true, nil
+	}
+	return "", false, &ProtoError{Proto: proto}
+}
@@ -0,0 +1,95 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestNewProxiedRequest_proto(t *testing.T) {
+	tests := []struct {
+		proto  string
+		scheme string
+		tls    bool
+	}{
+		{"http", "http", false},
+		{"HTTP", "http", false},
+		{"https", "https", true},
+		{"HTTPS", "https", true},
+		{"Https", "https", true},
+		{"ws", "ws", false},
+		{"wss", "wss", true},
+		{"WSS", "wss", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/path?q=1", nil)
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", "www.example.com")
+		req.Header.Add("X-Forwarded-Proto", tt.proto)
+
+		pr, err := proxyheaders.NewProxiedRequest(req)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("proto=%q: want=%v, got=%v", tt.proto, want, got)
+		}
+		if want, got := tt.scheme, pr.URL.Scheme; want != got {
+			t.Fatalf("proto=%q: want=%s, got=%s", tt.proto, want, got)
+		}
+		if want, got := "www.example.com", pr.URL.Host; want != got {
+			t.Fatalf("proto=%q: want=%s, got=%s", tt.proto, want, got)
+		}
+		if want, got := tt.scheme+"://www.example.com/path?q=1", pr.URL.String(); want != got {
+			t.Fatalf("proto=%q: want=%s, got=%s", tt.proto, want, got)
+		}
+		if want, got := tt.tls, pr.TLS != nil; want != got {
+			t.Fatalf("proto=%q: want=%t, got=%t", tt.proto, want, got)
+		}
+		if want, got := "localhost:8080", req.URL.Host; want != got {
+			t.Fatalf("original request modified: want=%s, got=%s", want, got)
+		}
+		if want, got := "1.2.3.4", req.Header.Get("X-Forwarded-For"); want != got {
+			t.Fatalf("original request modified: want=%s, got=%s", want, got)
+		}
+	}
+}
+
+func TestNewProxiedRequest_failInvalidXForwardedProto(t *testing.T) {
+	for _, proto := range []string{"ftp", "httpx", "garbage", "http s"} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", "www.example.com")
+		req.Header.Add("X-Forwarded-Proto", proto)
+
+		pr, err := proxyheaders.NewProxiedRequest(req)
+		if want, got := (*http.Request)(nil), pr; want != got {
+			t.Fatalf("proto=%q: want=nil, got!=nil", proto)
+		}
+		if !errors.Is(err, proxyheaders.ErrXForwardedProtoMustBeValid) {
+			t.Fatalf("proto=%q: want=%q, got=%q", proto, proxyheaders.ErrXForwardedProtoMustBeValid, err)
+		}
+		var protoErr *proxyheaders.ProtoError
+		if !errors.As(err, &protoErr) {
+			t.Fatalf("proto=%q: want *ProtoError, got %T", proto, err)
+		}
+		if want, got := proto, protoErr.Proto; want != got {
+			t.Fatalf("want=%q, got=%q", want, got)
+		}
+	}
+}
@@ -0,0 +1,702 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxiedhandler
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+	"gitlab.com/gopherburrow/proxyheaders/internal/lineno"
+)
+
+//ErrConfigFileMustBeValid is matched, using errors.Is, by every *ConfigFileError.
+var ErrConfigFileMustBeValid = errors.New("proxiedhandler: configuration file must be valid")
+
+//ConfigFile is the JSON configuration of a ProxiedHandler, read by ReadConfigFile and LoadConfigFile, so the proxy trust
+//can be configured without code changes. Eg:
+//
+//	{
+//	  "preset": {"name": "envoy", "num_trusted_hops": 1},
+//	  "trusted_proxies": ["10.0.0.0/8", "192.168.1.1"],
+//	  "allowed_hosts": ["www.example.com", "*.example.org"],
+//	  "duplicate_headers": "reject",
+//	  "client_cert": {"required": true, "ca_files": ["ca.pem"], "crl_files": ["ca.crl"]},
+//	  "report_only": false
+//	}
+//
+//Every field is optional and unknown fields are errors. The zero configuration is the same as a ProxiedHandler without
+//Config.
+//
+//The presets of known proxies (like "envoy" or "cloudflare") read the headers those proxies send, require the ones they
+//always send and decode the client certificates in the format they use, as documented by each proxyheaders.Preset. For
+//other proxies, the "cdn" preset (a proxyheaders.CDN) configures the header of each value, the fields whose header is
+//required ("host", "proto" and "cert"; the client address always is) and the client certificate format ("pem", "url-pem"
+//or "base64-der"). Eg:
+//
+//	{
+//	  "preset": {
+//	    "name": "cdn",
+//	    "ranges": ["198.51.100.0/24"],
+//	    "client_ip_header": "X-Client-IP",
+//	    "host_header": "X-Client-Host",
+//	    "proto_header": "X-Client-Proto",
+//	    "client_cert_header": "X-Client-Cert",
+//	    "client_cert_format": "base64-der",
+//	    "required": ["proto", "cert"]
+//	  },
+//	  "client_cert": {"ca_files": ["ca.pem"]}
+//	}
+type ConfigFile struct {
+	//Preset selects and configures the headers source. If absent, the X-Forwarded-* headers are used.
+	Preset *ConfigFilePreset `json:"preset,omitempty"`
+	//TrustedProxies are the CIDRs or addresses of proxyheaders.Config.TrustedProxies.
+	TrustedProxies []string `json:"trusted_proxies,omitempty"`
+	//TrustedProxyFiles are files with more trusted proxies, one per line (see proxyheaders.LoadPrefixFiles).
+	TrustedProxyFiles []string `json:"trusted_proxy_files,omitempty"`
+	//AllowedHosts are proxyheaders.Config.AllowedHosts.
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+	//DuplicateHeaders is the proxyheaders.Config.DuplicateHeaders policy name: "combine" (the default), "take-last" or "reject".
+	DuplicateHeaders string `json:"duplicate_headers,omitempty"`
+	//InvalidHops is the proxyheaders.Config.InvalidHops policy name: "reject" (the default) or "skip".
+	InvalidHops string `json:"invalid_hops,omitempty"`
+	//ClientCert configures the verification of the forwarded client certificates.
+	ClientCert *ConfigFileClientCert `json:"client_cert,omitempty"`
+	//ReportOnly is ProxiedHandler.ReportOnly: errors and violations are reported instead of rejecting the requests.
+	ReportOnly bool `json:"report_only,omitempty"`
+	//ServeOriginal is ProxiedHandler.ServeOriginal.
+	ServeOriginal bool `json:"serve_original,omitempty"`
+	//PassThroughDirect is ProxiedHandler.PassThroughDirect.
+	PassThroughDirect bool `json:"pass_through_direct,omitempty"`
+}
+
+//ConfigFilePreset is the "preset" of a ConfigFile. Only the options of the named preset can be set.
+type ConfigFilePreset struct {
+	//Name is the preset name, as in proxyheaders.PresetByName, or "cdn" for a custom proxyheaders.CDN.
+	Name string `json:"name"`
+	//Ranges are the CIDRs of the preset Ranges, replacing the published ones, if any.
+	Ranges []string `json:"ranges,omitempty"`
+	//NumTrustedHops is the "envoy" NumTrustedHops.
+	NumTrustedHops int `json:"num_trusted_hops,omitempty"`
+	//FrontDoorID is the "azure" FrontDoorID.
+	FrontDoorID string `json:"front_door_id,omitempty"`
+	//Header is the "nginx" or "apache" Header.
+	Header string `json:"header,omitempty"`
+	//Recursive is the "nginx" Recursive.
+	Recursive bool `json:"recursive,omitempty"`
+	//From are the CIDRs of the "nginx" From.
+	From []string `json:"from,omitempty"`
+	//Internal are the CIDRs of the "apache" Internal.
+	Internal []string `json:"internal,omitempty"`
+	//Trusted are the CIDRs of the "apache" Trusted.
+	Trusted []string `json:"trusted,omitempty"`
+	//ProxiesHeader is the "apache" ProxiesHeader.
+	ProxiesHeader string `json:"proxies_header,omitempty"`
+	//ClientIPHeader is the "cdn" ClientIPHeader.
+	ClientIPHeader string `json:"client_ip_header,omitempty"`
+	//HopCountHeader is the "cdn" HopCountHeader.
+	HopCountHeader string `json:"hop_count_header,omitempty"`
+	//SecureHeader is the "cdn" SecureHeader.
+	SecureHeader string `json:"secure_header,omitempty"`
+	//ProtoHeader is the "cdn" ProtoHeader.
+	ProtoHeader string `json:"proto_header,omitempty"`
+	//CountryHeader is the "cdn" CountryHeader.
+	CountryHeader string `json:"country_header,omitempty"`
+	//HostHeader is the "cdn" HostHeader.
+	HostHeader string `json:"host_header,omitempty"`
+	//PortHeader is the "cdn" PortHeader.
+	PortHeader string `json:"port_header,omitempty"`
+	//ClientCertHeader is the "cdn" ClientCertHeader.
+	ClientCertHeader string `json:"client_cert_header,omitempty"`
+	//ClientCertFormat is the name of the "cdn" ClientCertFormat: "pem" (the default), "url-pem" or "base64-der".
+	ClientCertFormat string `json:"client_cert_format,omitempty"`
+	//Required are the names of the "cdn" Required fields: "host", "proto" and "cert".
+	Required []string `json:"required,omitempty"`
+}
+
+//ConfigFileClientCert is the "client_cert" of a ConfigFile.
+type ConfigFileClientCert struct {
+	//Required is proxyheaders.Config.RequireClientCert.
+	Required bool `json:"required,omitempty"`
+	//CAFiles are PEM files with the proxyheaders.Config.ClientCAs certificates.
+	CAFiles []string `json:"ca_files,omitempty"`
+	//CRLFiles are PEM or DER files with the proxyheaders.Config.ClientCRLs. They require CAFiles.
+	CRLFiles []string `json:"crl_files,omitempty"`
+}
+
+//ConfigFileError is returned when a configuration file cannot be read or is invalid.
+//
+//It matches ErrConfigFileMustBeValid using errors.Is, and the cause using errors.Unwrap.
+type ConfigFileError struct {
+	//File is the configuration file path, if read by LoadConfigFile.
+	File string
+	//Line is the line of the offending value, or 0 if unknown.
+	Line int
+	//Field is the JSON path of the offending value, like "trusted_proxies[2]", if known.
+	Field string
+	//Err is the cause.
+	Err error
+}
+
+//Error implements the error interface.
+func (e *ConfigFileError) Error() string {
+	var b strings.Builder
+	b.WriteString("proxiedhandler: ")
+	if e.File != "" {
+		b.WriteString(e.File + ": ")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	if e.Field != "" {
+		b.WriteString(e.Field + ": ")
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+//Unwrap returns the cause.
+func (e *ConfigFileError) Unwrap() error {
+	return e.Err
+}
+
+//Is makes errors.Is(err, ErrConfigFileMustBeValid) true for any *ConfigFileError.
+func (e *ConfigFileError) Is(target error) bool {
+	return target == ErrConfigFileMustBeValid
+}
+
+//LoadConfigFile reads the configuration file at path and returns a ProxiedHandler configured by it, without Handler.
+//The files referenced by the configuration with relative paths are relative to the directory of path.
+//
+//To reload the proxyheaders.Config when the file changes, use a Reloadable with a Load function returning the Config of the
+//loaded handler.
+func LoadConfigFile(path string) (*ProxiedHandler, error) {
+	ph, _, err := loadConfigFile(path, true)
+	return ph, err
+}
+
+//loadConfigFile reads the configuration file at path, returning the handler configured by it and the JSON paths of the
+//values it sets. If validate is false the configuration is not checked with proxyheaders.Config.Validate, as it may be
+//completed later (see LoadEnv).
+func loadConfigFile(path string, validate bool) (*ProxiedHandler, map[string]int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, &ConfigFileError{File: path, Err: err}
+	}
+	ph, offsets, err := readConfigFile(data, filepath.Dir(path), validate)
+	var fileErr *ConfigFileError
+	if errors.As(err, &fileErr) {
+		fileErr.File = path
+	}
+	return ph, offsets, err
+}
+
+//ReadConfigFile reads a configuration file from r and returns a ProxiedHandler configured by it, without Handler.
+//The files referenced by the configuration with relative paths are relative to the working directory.
+//
+//The errors are *ConfigFileError, with the line of the offending value.
+func ReadConfigFile(r io.Reader) (*ProxiedHandler, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &ConfigFileError{Err: err}
+	}
+	ph, _, err := readConfigFile(data, "", true)
+	return ph, err
+}
+
+//readConfigFile decodes and builds the configuration in data, with relative paths resolved from dir. It also returns the
+//offsets of the values set, by JSON path. The configuration is checked with proxyheaders.Config.Validate if validate is set.
+func readConfigFile(data []byte, dir string, validate bool) (*ProxiedHandler, map[string]int64, error) {
+	f := &ConfigFile{}
+	if err := json.Unmarshal(data, f); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, nil, &ConfigFileError{Line: lineno.Of(data, syntaxErr.Offset), Err: err}
+		case errors.As(err, &typeErr):
+			return nil, nil, &ConfigFileError{Line: lineno.Of(data, typeErr.Offset), Field: typeErr.Field, Err: err}
+		}
+		return nil, nil, &ConfigFileError{Err: err}
+	}
+	s := &configFileScanner{data: data, dec: json.NewDecoder(bytes.NewReader(data)), offsets: map[string]int64{}}
+	if err := s.value(reflect.TypeOf(f), ""); err != nil {
+		return nil, nil, err
+	}
+	b := &configFileBuilder{configFileScanner: s, dir: dir, validate: validate}
+	ph, err := b.handler(f)
+	return ph, s.offsets, err
+}
+
+//configFileScanner walks the JSON tokens of a configuration file, rejecting unknown fields and recording the offsets of the values.
+type configFileScanner struct {
+	data []byte
+	dec  *json.Decoder
+	//offsets are the offsets of the values, by JSON path.
+	offsets map[string]int64
+}
+
+//value scans the value at path, of type t.
+func (s *configFileScanner) value(t reflect.Type, path string) error {
+	offset := s.dec.InputOffset()
+	for offset < int64(len(s.data)) && strings.IndexByte(" \t\r\n,:", s.data[offset]) >= 0 {
+		offset++
+	}
+	s.offsets[path] = offset
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	tok, err := s.dec.Token()
+	if err != nil {
+		return &ConfigFileError{Line: lineno.Of(s.data, offset), Field: path, Err: err}
+	}
+	switch tok {
+	case json.Delim('{'):
+		for s.dec.More() {
+			key, err := s.dec.Token()
+			if err != nil {
+				return &ConfigFileError{Line: lineno.Of(s.data, offset), Field: path, Err: err}
+			}
+			name := key.(string)
+			field, ok := jsonField(t, name)
+			if !ok {
+				return &ConfigFileError{Line: lineno.Of(s.data, s.dec.InputOffset()), Field: joinPath(path, name), Err: errors.New("unknown field")}
+			}
+			if err := s.value(field.Type, joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+	case json.Delim('['):
+		for i := 0; s.dec.More(); i++ {
+			if err := s.value(t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+	}
+	if err != nil {
+		return &ConfigFileError{Line: lineno.Of(s.data, offset), Field: path, Err: err}
+	}
+	return nil
+}
+
+//errorAt returns a *ConfigFileError at the line of the value at path or, if absent, of its nearest parent.
+func (s *configFileScanner) errorAt(path string, err error) error {
+	for p := path; ; {
+		if offset, ok := s.offsets[p]; ok {
+			return &ConfigFileError{Line: lineno.Of(s.data, offset), Field: path, Err: err}
+		}
+		i := strings.LastIndexAny(p, ".[")
+		if i < 0 {
+			p = ""
+			continue
+		}
+		p = p[:i]
+	}
+}
+
+//jsonField returns the field of the struct type t with the JSON name.
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+//joinPath returns the JSON path of the field name of parent.
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+//configFileBuilder builds a ProxiedHandler from a decoded configuration file.
+type configFileBuilder struct {
+	*configFileScanner
+	//dir is the directory of the relative paths.
+	dir string
+	//validate checks the built configuration with proxyheaders.Config.Validate.
+	validate bool
+}
+
+//handler builds the handler configured by f.
+func (b *configFileBuilder) handler(f *ConfigFile) (*ProxiedHandler, error) {
+	c := &proxyheaders.Config{AllowedHosts: f.AllowedHosts}
+	var err error
+
+	if f.Preset != nil {
+		if c.Preset, err = b.preset(f.Preset); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(f.TrustedProxies) > 0 || len(f.TrustedProxyFiles) > 0 {
+		if c.TrustedProxies, err = prefixSet("trusted_proxies", f.TrustedProxies, b.errorAt); err != nil {
+			return nil, err
+		}
+	}
+	for i, path := range f.TrustedProxyFiles {
+		set, err := proxyheaders.LoadPrefixFiles(b.path(path))
+		if err != nil {
+			return nil, b.errorAt(fmt.Sprintf("trusted_proxy_files[%d]", i), err)
+		}
+		c.TrustedProxies = proxyheaders.MergePrefixSets(c.TrustedProxies, set)
+	}
+
+	for i, host := range f.AllowedHosts {
+		if err := (&proxyheaders.Config{AllowedHosts: []string{host}}).Validate(); err != nil {
+			return nil, b.errorAt(fmt.Sprintf("allowed_hosts[%d]", i), err)
+		}
+	}
+
+	if c.DuplicateHeaders, err = duplicatePolicy(f.DuplicateHeaders); err != nil {
+		return nil, b.errorAt("duplicate_headers", err)
+	}
+	if c.InvalidHops, err = invalidHopPolicy(f.InvalidHops); err != nil {
+		return nil, b.errorAt("invalid_hops", err)
+	}
+
+	if cc := f.ClientCert; cc != nil {
+		c.RequireClientCert = cc.Required
+		if err := b.clientCert(c, cc); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.validate {
+		if err := c.Validate(); err != nil {
+			return nil, b.errorAt("", err)
+		}
+	}
+	return &ProxiedHandler{
+		Config:            c,
+		ReportOnly:        f.ReportOnly,
+		ServeOriginal:     f.ServeOriginal,
+		PassThroughDirect: f.PassThroughDirect,
+	}, nil
+}
+
+//preset builds the preset configured by fp.
+func (b *configFileBuilder) preset(fp *ConfigFilePreset) (proxyheaders.Preset, error) {
+	options := map[string]bool{
+		"ranges": len(fp.Ranges) > 0, "num_trusted_hops": fp.NumTrustedHops != 0, "front_door_id": fp.FrontDoorID != "",
+		"header": fp.Header != "", "recursive": fp.Recursive, "from": len(fp.From) > 0, "internal": len(fp.Internal) > 0,
+		"trusted": len(fp.Trusted) > 0, "proxies_header": fp.ProxiesHeader != "", "client_ip_header": fp.ClientIPHeader != "",
+		"hop_count_header": fp.HopCountHeader != "", "secure_header": fp.SecureHeader != "", "proto_header": fp.ProtoHeader != "",
+		"country_header": fp.CountryHeader != "", "host_header": fp.HostHeader != "", "port_header": fp.PortHeader != "",
+		"client_cert_header": fp.ClientCertHeader != "", "client_cert_format": fp.ClientCertFormat != "",
+		"required": len(fp.Required) > 0,
+	}
+	return buildPreset(fp, options, nil, b.errorAt)
+}
+
+//buildPreset builds the preset named by fp, setting the options set in options (by their JSON name). The options are set
+//on base if it has the same name, otherwise on the zero configuration of the preset. The errors are reported by fail, with
+//the JSON path of the offending value.
+func buildPreset(fp *ConfigFilePreset, options map[string]bool, base proxyheaders.Preset, fail func(path string, err error) error) (proxyheaders.Preset, error) {
+	//has reports if the option is set, removing it from the options not used by the preset.
+	has := func(name string) bool {
+		set := options[name]
+		delete(options, name)
+		return set
+	}
+	ranges, err := prefixSet("preset.ranges", fp.Ranges, fail)
+	if err != nil {
+		return nil, err
+	}
+	if fp.NumTrustedHops < 0 {
+		return nil, fail("preset.num_trusted_hops", errors.New("must not be negative"))
+	}
+
+	preset := base
+	if preset == nil || !strings.EqualFold(preset.Name(), strings.TrimSpace(fp.Name)) {
+		if strings.EqualFold(strings.TrimSpace(fp.Name), "cdn") {
+			preset = proxyheaders.CDN{ID: "cdn"}
+		} else if preset, err = proxyheaders.PresetByName(fp.Name); err != nil {
+			return nil, fail("preset.name", err)
+		}
+	}
+
+	switch p := preset.(type) {
+	case proxyheaders.CDN:
+		if has("ranges") {
+			p.Ranges = ranges
+		}
+		for _, o := range []struct {
+			name  string
+			value string
+			field *string
+		}{
+			{"client_ip_header", fp.ClientIPHeader, &p.ClientIPHeader},
+			{"hop_count_header", fp.HopCountHeader, &p.HopCountHeader},
+			{"secure_header", fp.SecureHeader, &p.SecureHeader},
+			{"proto_header", fp.ProtoHeader, &p.ProtoHeader},
+			{"country_header", fp.CountryHeader, &p.CountryHeader},
+			{"host_header", fp.HostHeader, &p.HostHeader},
+			{"port_header", fp.PortHeader, &p.PortHeader},
+			{"client_cert_header", fp.ClientCertHeader, &p.ClientCertHeader},
+		} {
+			if has(o.name) {
+				*o.field = o.value
+			}
+		}
+		if has("client_cert_format") {
+			if p.ClientCertFormat, err = certFormat(fp.ClientCertFormat); err != nil {
+				return nil, fail("preset.client_cert_format", err)
+			}
+		}
+		if has("required") {
+			p.Required = 0
+			for i, name := range fp.Required {
+				field, err := requiredField(name)
+				if err != nil {
+					return nil, fail(fmt.Sprintf("preset.required[%d]", i), err)
+				}
+				p.Required |= field
+			}
+		}
+		preset = p
+	case proxyheaders.Cloudflare:
+		if has("ranges") {
+			p.Ranges = ranges
+		}
+		preset = p
+	case proxyheaders.AWSALB:
+		if has("ranges") {
+			p.Ranges = ranges
+		}
+		preset = p
+	case proxyheaders.HAProxy:
+		if has("ranges") {
+			p.Ranges = ranges
+		}
+		preset = p
+	case proxyheaders.Google:
+		if has("ranges") {
+			p.Ranges = ranges
+		}
+		preset = p
+	case proxyheaders.Fastly:
+		if has("ranges") {
+			p.Ranges = ranges
+		}
+		preset = p
+	case proxyheaders.Akamai:
+		if has("ranges") {
+			p.Ranges = ranges
+		}
+		preset = p
+	case proxyheaders.Envoy:
+		if has("ranges") {
+			p.Ranges = ranges
+		}
+		if has("num_trusted_hops") {
+			p.NumTrustedHops = fp.NumTrustedHops
+		}
+		preset = p
+	case proxyheaders.Azure:
+		if has("ranges") {
+			p.Ranges = ranges
+		}
+		if has("front_door_id") {
+			p.FrontDoorID = fp.FrontDoorID
+		}
+		preset = p
+	case proxyheaders.NginxRealIP:
+		if has("from") {
+			if p.From, err = prefixSet("preset.from", fp.From, fail); err != nil {
+				return nil, err
+			}
+		}
+		if has("header") {
+			p.Header = fp.Header
+		}
+		if has("recursive") {
+			p.Recursive = fp.Recursive
+		}
+		preset = p
+	case proxyheaders.ApacheRemoteIP:
+		if has("internal") {
+			if p.Internal, err = prefixSet("preset.internal", fp.Internal, fail); err != nil {
+				return nil, err
+			}
+		}
+		if has("trusted") {
+			if p.Trusted, err = prefixSet("preset.trusted", fp.Trusted, fail); err != nil {
+				return nil, err
+			}
+		}
+		if has("header") {
+			p.Header = fp.Header
+		}
+		if has("proxies_header") {
+			p.ProxiesHeader = fp.ProxiesHeader
+		}
+		preset = p
+	}
+
+	var unused []string
+	for name, set := range options {
+		if set {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return nil, fail("preset."+unused[0], fmt.Errorf("option does not apply to the %q preset", preset.Name()))
+	}
+	return preset, nil
+}
+
+//clientCert loads the CAs and CRLs configured by cc in c.
+func (b *configFileBuilder) clientCert(c *proxyheaders.Config, cc *ConfigFileClientCert) error {
+	for i, path := range cc.CAFiles {
+		field := fmt.Sprintf("client_cert.ca_files[%d]", i)
+		data, err := os.ReadFile(b.path(path))
+		if err != nil {
+			return b.errorAt(field, err)
+		}
+		if c.ClientCAs == nil {
+			c.ClientCAs = x509.NewCertPool()
+		}
+		if !c.ClientCAs.AppendCertsFromPEM(data) {
+			return b.errorAt(field, errors.New("no PEM encoded certificates"))
+		}
+	}
+	for i, path := range cc.CRLFiles {
+		field := fmt.Sprintf("client_cert.crl_files[%d]", i)
+		crls, err := readCRLs(b.path(path))
+		if err != nil {
+			return b.errorAt(field, err)
+		}
+		c.ClientCRLs = append(c.ClientCRLs, crls...)
+	}
+	return nil
+}
+
+//prefixSet parses the CIDRs at path, or returns nil if there are none. The errors are reported by fail.
+func prefixSet(path string, cidrs []string, fail func(path string, err error) error) (*proxyheaders.PrefixSet, error) {
+	if len(cidrs) == 0 {
+		return nil, nil
+	}
+	set := proxyheaders.NewPrefixSet()
+	for i, cidr := range cidrs {
+		s, err := proxyheaders.ParsePrefixSet(cidr)
+		if err != nil {
+			return nil, fail(fmt.Sprintf("%s[%d]", path, i), err)
+		}
+		set.Add(s.Prefixes()...)
+	}
+	return set, nil
+}
+
+//path resolves a relative path from the builder directory.
+func (b *configFileBuilder) path(path string) string {
+	if b.dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(b.dir, path)
+}
+
+//readCRLs reads the PEM ("X509 CRL" blocks) or DER encoded revocation lists of the file at path.
+func readCRLs(path string) ([]*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var crls []*x509.RevocationList
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		crls = append(crls, crl)
+	}
+	if len(crls) > 0 {
+		return crls, nil
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.RevocationList{crl}, nil
+}
+
+//duplicatePolicy returns the policy with the name, or the default one if empty.
+func duplicatePolicy(name string) (proxyheaders.DuplicatePolicy, error) {
+	for _, p := range []proxyheaders.DuplicatePolicy{proxyheaders.DuplicateCombine, proxyheaders.DuplicateTakeLast, proxyheaders.DuplicateReject} {
+		if name == "" || strings.EqualFold(name, p.String()) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown policy %q", name)
+}
+
+//certFormat returns the certificate format with the name, or the default one if empty.
+func certFormat(name string) (proxyheaders.CertFormat, error) {
+	for _, f := range []proxyheaders.CertFormat{proxyheaders.CertFormatPEM, proxyheaders.CertFormatURLEncodedPEM, proxyheaders.CertFormatBase64DER} {
+		if name == "" || strings.EqualFold(name, f.String()) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown certificate format %q", name)
+}
+
+//requiredField returns the field, that can be required, with the name.
+func requiredField(name string) (proxyheaders.Field, error) {
+	for _, f := range []proxyheaders.Field{proxyheaders.FieldClientIP, proxyheaders.FieldHost, proxyheaders.FieldProto, proxyheaders.FieldClientCert} {
+		if strings.EqualFold(strings.TrimSpace(name), f.String()) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown field %q", name)
+}
+
+//invalidHopPolicy returns the policy with the name, or the default one if empty.
+func invalidHopPolicy(name string) (proxyheaders.InvalidHopPolicy, error) {
+	for _, p := range []proxyheaders.InvalidHopPolicy{proxyheaders.InvalidHopReject, proxyheaders.InvalidHopSkip} {
+		if name == "" || strings.EqualFold(name, p.String()) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown policy %q", name)
+}
@@ -0,0 +1,223 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxiedhandler_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+	"gitlab.com/gopherburrow/proxyheaders/proxiedhandler"
+)
+
+//writeCAFiles writes a CA certificate (ca.pem) and an empty CRL signed by it (ca.crl, DER) in dir.
+func writeCAFiles(t *testing.T, dir string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ca.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ca.crl"), crl, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	writeCAFiles(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "proxies.txt"), []byte("192.168.0.0/16\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "proxyheaders.json")
+	if err := os.WriteFile(path, []byte(`{
+  "preset": {"name": "envoy", "num_trusted_hops": 1, "ranges": ["172.16.0.0/12"]},
+  "trusted_proxies": ["10.0.0.0/8", "192.0.2.1"],
+  "trusted_proxy_files": ["proxies.txt"],
+  "allowed_hosts": ["www.example.com", "*.example.org"],
+  "duplicate_headers": "reject",
+  "invalid_hops": "skip",
+  "client_cert": {"required": true, "ca_files": ["ca.pem"], "crl_files": ["ca.crl"]},
+  "report_only": true,
+  "pass_through_direct": true
+}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ph, err := proxiedhandler.LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ph.Config
+	if want, got := (proxyheaders.Envoy{NumTrustedHops: 1}).Name(), c.Preset.Name(); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := 1, c.Preset.(proxyheaders.Envoy).NumTrustedHops; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if !c.Preset.TrustedProxies().Contains(netip.MustParseAddr("172.16.1.1")) {
+		t.Fatal("want=true, got=false")
+	}
+	for _, addr := range []string{"10.1.2.3", "192.0.2.1", "192.168.1.1"} {
+		if !c.TrustedProxies.Contains(netip.MustParseAddr(addr)) {
+			t.Fatalf("%s: want=true, got=false", addr)
+		}
+	}
+	if want, got := "www.example.com *.example.org", strings.Join(c.AllowedHosts, " "); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := proxyheaders.DuplicateReject, c.DuplicateHeaders; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := proxyheaders.InvalidHopSkip, c.InvalidHops; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if !c.RequireClientCert || c.ClientCAs == nil || len(c.ClientCRLs) != 1 {
+		t.Fatalf("want=client cert, got=%t %v %d", c.RequireClientCert, c.ClientCAs, len(c.ClientCRLs))
+	}
+	if !ph.ReportOnly || ph.ServeOriginal || !ph.PassThroughDirect {
+		t.Fatalf("want=true false true, got=%t %t %t", ph.ReportOnly, ph.ServeOriginal, ph.PassThroughDirect)
+	}
+
+	_, err = proxiedhandler.LoadConfigFile(filepath.Join(dir, "missing.json"))
+	if !errors.Is(err, os.ErrNotExist) || !errors.Is(err, proxiedhandler.ErrConfigFileMustBeValid) {
+		t.Fatalf("want=%v, got=%v", os.ErrNotExist, err)
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	ph, err := proxiedhandler.ReadConfigFile(strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := ph.Config; c.Preset != nil || c.TrustedProxies != nil || c.AllowedHosts != nil || c.ClientCAs != nil {
+		t.Fatalf("want=zero, got=%+v", c)
+	}
+
+	ph, err = proxiedhandler.ReadConfigFile(strings.NewReader(`{"preset": {"name": "nginx", "from": ["10.0.0.0/8"], "header": "X-Real-IP", "recursive": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nginx := ph.Config.Preset.(proxyheaders.NginxRealIP)
+	if want, got := "X-Real-IP", nginx.Header; !nginx.Recursive || !nginx.From.Contains(netip.MustParseAddr("10.0.0.1")) || want != got {
+		t.Fatalf("want=%s, got=%+v", want, nginx)
+	}
+
+	ph, err = proxiedhandler.ReadConfigFile(strings.NewReader(`{"preset": {"name": "cdn", "client_ip_header": "True-Client-IP", "ranges": ["198.51.100.0/24"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "True-Client-IP", ph.Config.Preset.(proxyheaders.CDN).ClientIPHeader; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//The header sources, the required fields and the certificate format of a custom CDN.
+	ph, err = proxiedhandler.ReadConfigFile(strings.NewReader(`{"preset": {"name": "cdn", "ranges": ["198.51.100.0/24"],
+		"host_header": "X-Client-Host", "port_header": "X-Client-Port", "client_cert_header": "X-Client-Cert",
+		"client_cert_format": "url-pem", "required": ["host", "cert"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := proxyheaders.CDN{
+		ID:               "cdn",
+		HostHeader:       "X-Client-Host",
+		PortHeader:       "X-Client-Port",
+		ClientCertHeader: "X-Client-Cert",
+		ClientCertFormat: proxyheaders.CertFormatURLEncodedPEM,
+		Required:         proxyheaders.FieldHost | proxyheaders.FieldClientCert,
+	}
+	cdn := ph.Config.Preset.(proxyheaders.CDN)
+	cdn.Ranges = nil
+	if want != cdn {
+		t.Fatalf("want=%+v, got=%+v", want, cdn)
+	}
+}
+
+func TestReadConfigFile_fail(t *testing.T) {
+	for _, tc := range []struct {
+		file  string
+		line  int
+		field string
+	}{
+		{"{\n  \"allowed_hosts\": [\"a\",]\n}", 2, ""},
+		{"{\n  \"report_only\": true,\n  \"reportonly\": true\n}", 3, "reportonly"},
+		{"{\n  \"preset\": {\n    \"name\": \"envoy\",\n    \"hops\": 1\n  }\n}", 4, "preset.hops"},
+		{"{\n  \"trusted_proxies\": \"10.0.0.0/8\"\n}", 2, "trusted_proxies"},
+		{"{\n  \"trusted_proxies\": [\n    \"10.0.0.0/8\",\n    \"10.0.0.0/33\"\n  ]\n}", 4, "trusted_proxies[1]"},
+		{"{\n  \"preset\": {\"name\": \"gopher\"}\n}", 2, "preset.name"},
+		{"{\n  \"preset\": {\n    \"name\": \"envoy\",\n    \"recursive\": true\n  }\n}", 4, "preset.recursive"},
+		{"{\n  \"preset\": {\n    \"name\": \"heroku\",\n    \"ranges\": [\"10.0.0.0/8\"]\n  }\n}", 4, "preset.ranges"},
+		{"{\n  \"preset\": {\"name\": \"envoy\", \"num_trusted_hops\": -1}\n}", 2, "preset.num_trusted_hops"},
+		{"{\n  \"duplicate_headers\": \"first\"\n}", 2, "duplicate_headers"},
+		{"{\n  \"preset\": {\n    \"name\": \"cdn\",\n    \"client_cert_format\": \"der\"\n  }\n}", 4, "preset.client_cert_format"},
+		{"{\n  \"preset\": {\n    \"name\": \"cdn\",\n    \"required\": [\n      \"host\",\n      \"port\"\n    ]\n  }\n}", 6, "preset.required[1]"},
+		{"{\n  \"preset\": {\n    \"name\": \"envoy\",\n    \"required\": [\"host\"]\n  }\n}", 4, "preset.required"},
+		{"{\n  \"allowed_hosts\": [\n    \"www.example.com:443\"\n  ]\n}", 3, "allowed_hosts[0]"},
+		{"{\n  \"client_cert\": {\n    \"ca_files\": [\"missing.pem\"]\n  }\n}", 3, "client_cert.ca_files[0]"},
+		{"{\n  \"client_cert\": {}\n}\n{}", 4, ""},
+	} {
+		_, err := proxiedhandler.ReadConfigFile(strings.NewReader(tc.file))
+		var fileErr *proxiedhandler.ConfigFileError
+		if !errors.As(err, &fileErr) || !errors.Is(err, proxiedhandler.ErrConfigFileMustBeValid) {
+			t.Fatalf("%s: want=%v, got=%v", tc.file, proxiedhandler.ErrConfigFileMustBeValid, err)
+		}
+		if want, got := tc.line, fileErr.Line; want != got {
+			t.Fatalf("%s: want=%d, got=%d (%v)", tc.file, want, got, err)
+		}
+		if want, got := tc.field, fileErr.Field; want != got {
+			t.Fatalf("%s: want=%s, got=%s (%v)", tc.file, want, got, err)
+		}
+	}
+}
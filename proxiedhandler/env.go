@@ -0,0 +1,433 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxiedhandler
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+//The environment variables read by LoadEnv.
+const (
+	//EnvConfigFile is the path of a configuration file, read by LoadConfigFile.
+	EnvConfigFile = "PROXYHEADERS_CONFIG_FILE"
+	//EnvTrustedProxies are the CIDRs or addresses of proxyheaders.Config.TrustedProxies, separated by commas or spaces.
+	EnvTrustedProxies = "PROXYHEADERS_TRUSTED_PROXIES"
+	//EnvPreset is the name of proxyheaders.Config.Preset, as in proxyheaders.PresetByName.
+	EnvPreset = "PROXYHEADERS_PRESET"
+	//EnvAllowedHosts are the proxyheaders.Config.AllowedHosts, separated by commas or spaces.
+	EnvAllowedHosts = "PROXYHEADERS_ALLOWED_HOSTS"
+	//EnvClientCAFile are the PEM files with the proxyheaders.Config.ClientCAs, separated by the os.PathListSeparator.
+	EnvClientCAFile = "PROXYHEADERS_CLIENT_CA_FILE"
+	//EnvClientCRLFile are the PEM or DER files with the proxyheaders.Config.ClientCRLs, separated by the os.PathListSeparator.
+	EnvClientCRLFile = "PROXYHEADERS_CLIENT_CRL_FILE"
+	//EnvRequireClientCert is proxyheaders.Config.RequireClientCert, a boolean as in strconv.ParseBool.
+	EnvRequireClientCert = "PROXYHEADERS_REQUIRE_CLIENT_CERT"
+	//EnvDuplicateHeaders is the proxyheaders.Config.DuplicateHeaders policy name: "combine", "take-last" or "reject".
+	EnvDuplicateHeaders = "PROXYHEADERS_DUPLICATE_HEADERS"
+	//EnvInvalidHops is the proxyheaders.Config.InvalidHops policy name: "reject" or "skip".
+	EnvInvalidHops = "PROXYHEADERS_INVALID_HOPS"
+	//EnvReportOnly is ProxiedHandler.ReportOnly, a boolean as in strconv.ParseBool.
+	EnvReportOnly = "PROXYHEADERS_REPORT_ONLY"
+	//EnvServeOriginal is ProxiedHandler.ServeOriginal, a boolean as in strconv.ParseBool.
+	EnvServeOriginal = "PROXYHEADERS_SERVE_ORIGINAL"
+	//EnvPassThroughDirect is ProxiedHandler.PassThroughDirect, a boolean as in strconv.ParseBool.
+	EnvPassThroughDirect = "PROXYHEADERS_PASS_THROUGH_DIRECT"
+)
+
+//The environment variables of the preset options read by LoadEnv. They are the options of ConfigFilePreset, with the same
+//rules: an option that does not apply to the preset is an error.
+const (
+	//EnvPresetRanges are the CIDRs of the preset Ranges, separated by commas or spaces.
+	EnvPresetRanges = "PROXYHEADERS_PRESET_RANGES"
+	//EnvPresetNumTrustedHops is the "envoy" NumTrustedHops.
+	EnvPresetNumTrustedHops = "PROXYHEADERS_PRESET_NUM_TRUSTED_HOPS"
+	//EnvPresetFrontDoorID is the "azure" FrontDoorID.
+	EnvPresetFrontDoorID = "PROXYHEADERS_PRESET_FRONT_DOOR_ID"
+	//EnvPresetHeader is the "nginx" or "apache" Header.
+	EnvPresetHeader = "PROXYHEADERS_PRESET_HEADER"
+	//EnvPresetRecursive is the "nginx" Recursive, a boolean as in strconv.ParseBool.
+	EnvPresetRecursive = "PROXYHEADERS_PRESET_RECURSIVE"
+	//EnvPresetFrom are the CIDRs of the "nginx" From, separated by commas or spaces.
+	EnvPresetFrom = "PROXYHEADERS_PRESET_FROM"
+	//EnvPresetInternal are the CIDRs of the "apache" Internal, separated by commas or spaces.
+	EnvPresetInternal = "PROXYHEADERS_PRESET_INTERNAL"
+	//EnvPresetTrusted are the CIDRs of the "apache" Trusted, separated by commas or spaces.
+	EnvPresetTrusted = "PROXYHEADERS_PRESET_TRUSTED"
+	//EnvPresetProxiesHeader is the "apache" ProxiesHeader.
+	EnvPresetProxiesHeader = "PROXYHEADERS_PRESET_PROXIES_HEADER"
+	//EnvPresetClientIPHeader is the "cdn" ClientIPHeader.
+	EnvPresetClientIPHeader = "PROXYHEADERS_PRESET_CLIENT_IP_HEADER"
+	//EnvPresetHopCountHeader is the "cdn" HopCountHeader.
+	EnvPresetHopCountHeader = "PROXYHEADERS_PRESET_HOP_COUNT_HEADER"
+	//EnvPresetSecureHeader is the "cdn" SecureHeader.
+	EnvPresetSecureHeader = "PROXYHEADERS_PRESET_SECURE_HEADER"
+	//EnvPresetProtoHeader is the "cdn" ProtoHeader.
+	EnvPresetProtoHeader = "PROXYHEADERS_PRESET_PROTO_HEADER"
+	//EnvPresetCountryHeader is the "cdn" CountryHeader.
+	EnvPresetCountryHeader = "PROXYHEADERS_PRESET_COUNTRY_HEADER"
+	//EnvPresetHostHeader is the "cdn" HostHeader.
+	EnvPresetHostHeader = "PROXYHEADERS_PRESET_HOST_HEADER"
+	//EnvPresetPortHeader is the "cdn" PortHeader.
+	EnvPresetPortHeader = "PROXYHEADERS_PRESET_PORT_HEADER"
+	//EnvPresetClientCertHeader is the "cdn" ClientCertHeader.
+	EnvPresetClientCertHeader = "PROXYHEADERS_PRESET_CLIENT_CERT_HEADER"
+	//EnvPresetClientCertFormat is the name of the "cdn" ClientCertFormat: "pem", "url-pem" or "base64-der".
+	EnvPresetClientCertFormat = "PROXYHEADERS_PRESET_CLIENT_CERT_FORMAT"
+	//EnvPresetRequired are the names of the "cdn" Required fields, separated by commas or spaces: "host", "proto" and "cert".
+	EnvPresetRequired = "PROXYHEADERS_PRESET_REQUIRED"
+)
+
+//ErrEnvMustBeValid is returned by LoadEnv when an environment variable has an invalid value. The actual error returned
+//wraps this one, with the variable name and the problem found.
+var ErrEnvMustBeValid = errors.New("proxiedhandler: environment variable must be valid")
+
+//LoadEnv returns a copy of base, configured by the PROXYHEADERS_* environment variables (see EnvConfigFile and the
+//following constants), for container deployments. A nil base is the same as an empty ProxiedHandler.
+//
+//The precedence, from the lowest to the highest, is:
+//
+//• base, the programmatic configuration;
+//
+//• the configuration file of EnvConfigFile, if set. Each value the file sets replaces the field it configures, the others
+//(and the Handler, ErrorHandler, etc) are kept;
+//
+//• each one of the other variables set, replacing the field it configures.
+//
+//Variables set to an empty value are ignored. The preset options (see EnvPresetRanges and the following constants) are set
+//on the preset of EnvPreset or, if unset, the one already configured. If EnvPreset names the preset already configured, the
+//options not set are kept, otherwise the preset has its zero configuration (see proxyheaders.PresetByName), or is a custom
+//proxyheaders.CDN for "cdn". Only the resulting configuration is checked with proxyheaders.Config.Validate, so the file can
+//be completed by the variables (eg: EnvPresetFrontDoorID for the "azure" preset of the file). Use DumpConfig to log
+//the effective configuration.
+func LoadEnv(base *ProxiedHandler) (*ProxiedHandler, error) {
+	ph := &ProxiedHandler{}
+	if base != nil {
+		*ph = *base
+	}
+	c := &proxyheaders.Config{}
+	if ph.Config != nil {
+		*c = *ph.Config
+	}
+	ph.Config = c
+
+	if path := os.Getenv(EnvConfigFile); path != "" {
+		//The file is validated merged with the variables, which may complete it.
+		file, offsets, err := loadConfigFile(path, false)
+		if err != nil {
+			return nil, err
+		}
+		set := func(path string) bool {
+			_, ok := offsets[path]
+			return ok
+		}
+		fc := file.Config
+		if set("preset") {
+			c.Preset = fc.Preset
+		}
+		if set("trusted_proxies") || set("trusted_proxy_files") {
+			c.TrustedProxies = fc.TrustedProxies
+		}
+		if set("allowed_hosts") {
+			c.AllowedHosts = fc.AllowedHosts
+		}
+		if set("duplicate_headers") {
+			c.DuplicateHeaders = fc.DuplicateHeaders
+		}
+		if set("invalid_hops") {
+			c.InvalidHops = fc.InvalidHops
+		}
+		if set("client_cert.required") {
+			c.RequireClientCert = fc.RequireClientCert
+		}
+		if set("client_cert.ca_files") {
+			c.ClientCAs = fc.ClientCAs
+		}
+		if set("client_cert.crl_files") {
+			c.ClientCRLs = fc.ClientCRLs
+		}
+		if set("report_only") {
+			ph.ReportOnly = file.ReportOnly
+		}
+		if set("serve_original") {
+			ph.ServeOriginal = file.ServeOriginal
+		}
+		if set("pass_through_direct") {
+			ph.PassThroughDirect = file.PassThroughDirect
+		}
+	}
+
+	if v := os.Getenv(EnvTrustedProxies); v != "" {
+		set, err := proxyheaders.ParsePrefixSet(splitEnvList(v)...)
+		if err != nil {
+			return nil, envError(EnvTrustedProxies, err)
+		}
+		c.TrustedProxies = set
+	}
+	if err := loadEnvPreset(c); err != nil {
+		return nil, err
+	}
+	if v := os.Getenv(EnvAllowedHosts); v != "" {
+		c.AllowedHosts = splitEnvList(v)
+	}
+	if v := os.Getenv(EnvClientCAFile); v != "" {
+		c.ClientCAs = x509.NewCertPool()
+		for _, path := range filepath.SplitList(v) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, envError(EnvClientCAFile, err)
+			}
+			if !c.ClientCAs.AppendCertsFromPEM(data) {
+				return nil, envError(EnvClientCAFile, fmt.Errorf("no PEM encoded certificates in %s", path))
+			}
+		}
+	}
+	if v := os.Getenv(EnvClientCRLFile); v != "" {
+		c.ClientCRLs = nil
+		for _, path := range filepath.SplitList(v) {
+			crls, err := readCRLs(path)
+			if err != nil {
+				return nil, envError(EnvClientCRLFile, err)
+			}
+			c.ClientCRLs = append(c.ClientCRLs, crls...)
+		}
+	}
+	var err error
+	if v := os.Getenv(EnvDuplicateHeaders); v != "" {
+		if c.DuplicateHeaders, err = duplicatePolicy(v); err != nil {
+			return nil, envError(EnvDuplicateHeaders, err)
+		}
+	}
+	if v := os.Getenv(EnvInvalidHops); v != "" {
+		if c.InvalidHops, err = invalidHopPolicy(v); err != nil {
+			return nil, envError(EnvInvalidHops, err)
+		}
+	}
+	for _, b := range []struct {
+		name string
+		v    *bool
+	}{
+		{EnvRequireClientCert, &c.RequireClientCert},
+		{EnvReportOnly, &ph.ReportOnly},
+		{EnvServeOriginal, &ph.ServeOriginal},
+		{EnvPassThroughDirect, &ph.PassThroughDirect},
+	} {
+		if v := os.Getenv(b.name); v != "" {
+			if *b.v, err = strconv.ParseBool(v); err != nil {
+				return nil, envError(b.name, err)
+			}
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return ph, nil
+}
+
+//loadEnvPreset sets the preset of EnvPreset and its options in c.
+func loadEnvPreset(c *proxyheaders.Config) error {
+	fp := &ConfigFilePreset{Name: strings.TrimSpace(os.Getenv(EnvPreset))}
+	options := map[string]bool{}
+	for _, o := range []struct {
+		name   string
+		option string
+		value  *string
+	}{
+		{EnvPresetFrontDoorID, "front_door_id", &fp.FrontDoorID},
+		{EnvPresetHeader, "header", &fp.Header},
+		{EnvPresetProxiesHeader, "proxies_header", &fp.ProxiesHeader},
+		{EnvPresetClientIPHeader, "client_ip_header", &fp.ClientIPHeader},
+		{EnvPresetHopCountHeader, "hop_count_header", &fp.HopCountHeader},
+		{EnvPresetSecureHeader, "secure_header", &fp.SecureHeader},
+		{EnvPresetProtoHeader, "proto_header", &fp.ProtoHeader},
+		{EnvPresetCountryHeader, "country_header", &fp.CountryHeader},
+		{EnvPresetHostHeader, "host_header", &fp.HostHeader},
+		{EnvPresetPortHeader, "port_header", &fp.PortHeader},
+		{EnvPresetClientCertHeader, "client_cert_header", &fp.ClientCertHeader},
+		{EnvPresetClientCertFormat, "client_cert_format", &fp.ClientCertFormat},
+	} {
+		if *o.value = strings.TrimSpace(os.Getenv(o.name)); *o.value != "" {
+			options[o.option] = true
+		}
+	}
+	for _, o := range []struct {
+		name   string
+		option string
+		value  *[]string
+	}{
+		{EnvPresetRanges, "ranges", &fp.Ranges},
+		{EnvPresetFrom, "from", &fp.From},
+		{EnvPresetInternal, "internal", &fp.Internal},
+		{EnvPresetTrusted, "trusted", &fp.Trusted},
+		{EnvPresetRequired, "required", &fp.Required},
+	} {
+		if *o.value = splitEnvList(os.Getenv(o.name)); len(*o.value) > 0 {
+			options[o.option] = true
+		}
+	}
+	var err error
+	if v := os.Getenv(EnvPresetNumTrustedHops); v != "" {
+		if fp.NumTrustedHops, err = strconv.Atoi(v); err != nil {
+			return envError(EnvPresetNumTrustedHops, err)
+		}
+		options["num_trusted_hops"] = true
+	}
+	if v := os.Getenv(EnvPresetRecursive); v != "" {
+		if fp.Recursive, err = strconv.ParseBool(v); err != nil {
+			return envError(EnvPresetRecursive, err)
+		}
+		options["recursive"] = true
+	}
+
+	if fp.Name == "" && len(options) == 0 {
+		return nil
+	}
+	if fp.Name == "" {
+		fp.Name = proxyheaders.XForwarded{}.Name()
+		if c.Preset != nil {
+			fp.Name = c.Preset.Name()
+		}
+	}
+	c.Preset, err = buildPreset(fp, options, c.Preset, presetEnvError)
+	return err
+}
+
+//presetEnvError returns the error of the preset option at the configuration file path, with the name of its variable.
+func presetEnvError(path string, err error) error {
+	option, _, _ := strings.Cut(strings.TrimPrefix(path, "preset."), "[")
+	if option == "name" {
+		return envError(EnvPreset, err)
+	}
+	return envError("PROXYHEADERS_PRESET_"+strings.ToUpper(option), err)
+}
+
+//envError returns an error wrapping ErrEnvMustBeValid, with the variable name and err.
+func envError(name string, err error) error {
+	return fmt.Errorf("%w: %s: %v", ErrEnvMustBeValid, name, err)
+}
+
+//splitEnvList splits a list separated by commas or spaces.
+func splitEnvList(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+//DumpConfig returns the effective configuration of ph (its Reloadable current configuration, if any), one "name: value"
+//per line, with the names of the configuration file, the preset options included. Empty values are "-". It is meant to be
+//logged at startup, to tell the result of the programmatic, file and environment configurations. A nil ph is the same as
+//an empty ProxiedHandler.
+//
+//The preset ranges are the ones in effect, the published ones if not configured. The client CAs are not listed, only
+//reported as set, and the CRLs are counted.
+func DumpConfig(ph *ProxiedHandler) string {
+	if ph == nil {
+		ph = &ProxiedHandler{}
+	}
+	c := ph.config()
+	if c == nil {
+		c = &proxyheaders.Config{}
+	}
+	preset := c.Preset
+	if preset == nil {
+		preset = proxyheaders.XForwarded{}
+	}
+	var b strings.Builder
+	line := func(name string, value interface{}) {
+		fmt.Fprintf(&b, "%s: %v\n", name, value)
+	}
+	line("preset.name", preset.Name())
+	switch p := preset.(type) {
+	case proxyheaders.CDN:
+		line("preset.ranges", prefixList(p.TrustedProxies()))
+		line("preset.client_ip_header", stringValue(p.ClientIPHeader))
+		line("preset.hop_count_header", stringValue(p.HopCountHeader))
+		line("preset.secure_header", stringValue(p.SecureHeader))
+		line("preset.proto_header", stringValue(p.ProtoHeader))
+		line("preset.country_header", stringValue(p.CountryHeader))
+		line("preset.host_header", stringValue(p.HostHeader))
+		line("preset.port_header", stringValue(p.PortHeader))
+		line("preset.client_cert_header", stringValue(p.ClientCertHeader))
+		line("preset.client_cert_format", p.ClientCertFormat)
+		line("preset.required", stringValue(strings.ReplaceAll(p.Required.String(), "|", " ")))
+	case proxyheaders.Envoy:
+		line("preset.ranges", prefixList(p.TrustedProxies()))
+		line("preset.num_trusted_hops", p.NumTrustedHops)
+	case proxyheaders.Azure:
+		line("preset.ranges", prefixList(p.TrustedProxies()))
+		line("preset.front_door_id", stringValue(p.FrontDoorID))
+	case proxyheaders.NginxRealIP:
+		line("preset.from", prefixList(p.From))
+		line("preset.header", stringValue(p.Header))
+		line("preset.recursive", p.Recursive)
+	case proxyheaders.ApacheRemoteIP:
+		line("preset.internal", prefixList(p.Internal))
+		line("preset.trusted", prefixList(p.Trusted))
+		line("preset.header", stringValue(p.Header))
+		line("preset.proxies_header", stringValue(p.ProxiesHeader))
+	case proxyheaders.Cloudflare, proxyheaders.AWSALB, proxyheaders.HAProxy, proxyheaders.Google, proxyheaders.Fastly, proxyheaders.Akamai:
+		line("preset.ranges", prefixList(p.TrustedProxies()))
+	}
+	line("trusted_proxies", prefixList(c.TrustedProxies))
+	line("allowed_hosts", listValue(c.AllowedHosts))
+	line("duplicate_headers", c.DuplicateHeaders)
+	line("invalid_hops", c.InvalidHops)
+	line("client_cert.required", c.RequireClientCert)
+	cas := "-"
+	if c.ClientCAs != nil {
+		cas = "set"
+	}
+	line("client_cert.ca_files", cas)
+	line("client_cert.crl_files", len(c.ClientCRLs))
+	line("report_only", ph.ReportOnly || c.ReportOnly)
+	line("serve_original", ph.ServeOriginal)
+	line("pass_through_direct", ph.PassThroughDirect)
+	line("reloadable", ph.Reloadable != nil)
+	return b.String()
+}
+
+//prefixList returns the prefixes of set as a list value.
+func prefixList(set *proxyheaders.PrefixSet) string {
+	var s []string
+	for _, p := range set.Prefixes() {
+		s = append(s, p.String())
+	}
+	return listValue(s)
+}
+
+//stringValue returns s, or "-" if it is empty.
+func stringValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+//listValue returns the values separated by spaces, or "-" if there are none.
+func listValue(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, " ")
+}
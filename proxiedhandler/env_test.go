@@ -0,0 +1,291 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxiedhandler_test
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+	"gitlab.com/gopherburrow/proxyheaders/proxiedhandler"
+)
+
+func TestLoadEnv(t *testing.T) {
+	dir := t.TempDir()
+	writeCAFiles(t, dir)
+	path := filepath.Join(dir, "proxyheaders.json")
+	if err := os.WriteFile(path, []byte(`{
+  "preset": {"name": "envoy", "num_trusted_hops": 2},
+  "trusted_proxies": ["10.0.0.0/8"],
+  "allowed_hosts": ["www.example.com"],
+  "duplicate_headers": "reject",
+  "report_only": true
+}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	base := &proxiedhandler.ProxiedHandler{
+		Handler:           http.HandlerFunc(DumpServeHTTP),
+		Config:            &proxyheaders.Config{InvalidHops: proxyheaders.InvalidHopSkip},
+		PassThroughDirect: true,
+	}
+
+	//Without variables, the programmatic configuration is used.
+	ph, err := proxiedhandler.LoadEnv(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := proxyheaders.InvalidHopSkip, ph.Config.InvalidHops; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if ph.Config == base.Config {
+		t.Fatal("want=copy, got=base config")
+	}
+
+	//The file replaces the programmatic configuration it sets, and the variables replace the file fields.
+	t.Setenv(proxiedhandler.EnvConfigFile, path)
+	t.Setenv(proxiedhandler.EnvTrustedProxies, "192.0.2.1, 198.51.100.0/24")
+	t.Setenv(proxiedhandler.EnvPreset, "Envoy")
+	t.Setenv(proxiedhandler.EnvAllowedHosts, "api.example.com *.example.org")
+	t.Setenv(proxiedhandler.EnvClientCAFile, filepath.Join(dir, "ca.pem"))
+	t.Setenv(proxiedhandler.EnvClientCRLFile, filepath.Join(dir, "ca.crl"))
+	t.Setenv(proxiedhandler.EnvRequireClientCert, "true")
+	t.Setenv(proxiedhandler.EnvReportOnly, "false")
+	t.Setenv(proxiedhandler.EnvDuplicateHeaders, "")
+	ph, err = proxiedhandler.LoadEnv(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ph.Config
+	if ph.Handler == nil {
+		t.Fatal("want=handler, got=nil")
+	}
+	if want, got := 2, c.Preset.(proxyheaders.Envoy).NumTrustedHops; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if c.TrustedProxies.Contains(netip.MustParseAddr("10.0.0.1")) || !c.TrustedProxies.Contains(netip.MustParseAddr("198.51.100.7")) {
+		t.Fatalf("want=192.0.2.1/32 198.51.100.0/24, got=%v", c.TrustedProxies.Prefixes())
+	}
+	if want, got := "api.example.com *.example.org", strings.Join(c.AllowedHosts, " "); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := proxyheaders.DuplicateReject, c.DuplicateHeaders; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	//Not set by the file.
+	if want, got := proxyheaders.InvalidHopSkip, c.InvalidHops; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := true, ph.PassThroughDirect; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if !c.RequireClientCert || c.ClientCAs == nil || len(c.ClientCRLs) != 1 || ph.ReportOnly {
+		t.Fatalf("want=client cert, got=%t %v %d %t", c.RequireClientCert, c.ClientCAs, len(c.ClientCRLs), ph.ReportOnly)
+	}
+
+	want := `preset.name: envoy
+preset.ranges: -
+preset.num_trusted_hops: 2
+trusted_proxies: 192.0.2.1/32 198.51.100.0/24
+allowed_hosts: api.example.com *.example.org
+duplicate_headers: reject
+invalid_hops: skip
+client_cert.required: true
+client_cert.ca_files: set
+client_cert.crl_files: 1
+report_only: false
+serve_original: false
+pass_through_direct: true
+reloadable: false
+`
+	if got := proxiedhandler.DumpConfig(ph); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//The preset options are set on the configured preset.
+	t.Setenv(proxiedhandler.EnvPreset, "")
+	t.Setenv(proxiedhandler.EnvPresetRanges, "172.16.0.0/12")
+	t.Setenv(proxiedhandler.EnvServeOriginal, "true")
+	if ph, err = proxiedhandler.LoadEnv(base); err != nil {
+		t.Fatal(err)
+	}
+	envoy := ph.Config.Preset.(proxyheaders.Envoy)
+	if want, got := 2, envoy.NumTrustedHops; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if !envoy.Ranges.Contains(netip.MustParseAddr("172.16.0.1")) {
+		t.Fatalf("want=172.16.0.0/12, got=%v", envoy.Ranges.Prefixes())
+	}
+	if want, got := true, ph.ServeOriginal; want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	t.Setenv(proxiedhandler.EnvPresetRanges, "")
+
+	t.Setenv(proxiedhandler.EnvPreset, "azure")
+	t.Setenv(proxiedhandler.EnvPresetFrontDoorID, "a0b1c2d3-e4f5-6789-abcd-ef0123456789")
+	if ph, err = proxiedhandler.LoadEnv(base); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "a0b1c2d3-e4f5-6789-abcd-ef0123456789", ph.Config.Preset.(proxyheaders.Azure).FrontDoorID; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	t.Setenv(proxiedhandler.EnvPresetFrontDoorID, "")
+
+	//A different preset has its zero configuration.
+	t.Setenv(proxiedhandler.EnvPreset, "cloudflare")
+	if ph, err = proxiedhandler.LoadEnv(base); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := (proxyheaders.Cloudflare{}), ph.Config.Preset; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestLoadEnv_fileCompletedByEnv(t *testing.T) {
+	dir := t.TempDir()
+	writeCAFiles(t, dir)
+	path := filepath.Join(dir, "proxyheaders.json")
+	if err := os.WriteFile(path, []byte(`{
+  "preset": {"name": "azure"},
+  "client_cert": {"crl_files": ["ca.crl"]}
+}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	//The file alone is not valid: it trusts any Front Door, and has CRLs without CAs.
+	if _, err := proxiedhandler.LoadConfigFile(path); !errors.Is(err, proxyheaders.ErrConfigMustBeValid) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrConfigMustBeValid, err)
+	}
+
+	t.Setenv(proxiedhandler.EnvConfigFile, path)
+	t.Setenv(proxiedhandler.EnvPresetFrontDoorID, "a0b1c2d3-e4f5-6789-abcd-ef0123456789")
+	t.Setenv(proxiedhandler.EnvClientCAFile, filepath.Join(dir, "ca.pem"))
+	ph, err := proxiedhandler.LoadEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := (proxyheaders.Azure{FrontDoorID: "a0b1c2d3-e4f5-6789-abcd-ef0123456789"}), ph.Config.Preset; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := 1, len(ph.Config.ClientCRLs); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if ph.Config.ClientCAs == nil {
+		t.Fatal("want=CAs, got=nil")
+	}
+}
+
+func TestLoadEnv_fail(t *testing.T) {
+	for name, value := range map[string]string{
+		proxiedhandler.EnvTrustedProxies:    "10.0.0.0/8, gopher",
+		proxiedhandler.EnvPreset:            "gopher",
+		proxiedhandler.EnvClientCAFile:      filepath.Join(t.TempDir(), "missing.pem"),
+		proxiedhandler.EnvClientCRLFile:     filepath.Join(t.TempDir(), "missing.crl"),
+		proxiedhandler.EnvRequireClientCert: "maybe",
+		proxiedhandler.EnvDuplicateHeaders:  "first",
+		proxiedhandler.EnvInvalidHops:       "drop",
+		proxiedhandler.EnvServeOriginal:     "maybe",
+		//The options of a preset, that does not have them.
+		proxiedhandler.EnvPresetRanges:         "10.0.0.0/8",
+		proxiedhandler.EnvPresetFrontDoorID:    "a0b1c2d3-e4f5-6789-abcd-ef0123456789",
+		proxiedhandler.EnvPresetNumTrustedHops: "many",
+		proxiedhandler.EnvPresetRecursive:      "maybe",
+		proxiedhandler.EnvPresetFrom:           "gopher",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			_, err := proxiedhandler.LoadEnv(nil)
+			if !errors.Is(err, proxiedhandler.ErrEnvMustBeValid) || !strings.Contains(err.Error(), name) {
+				t.Fatalf("want=%v, got=%v", proxiedhandler.ErrEnvMustBeValid, err)
+			}
+		})
+	}
+
+	t.Setenv(proxiedhandler.EnvAllowedHosts, "www.example.com:443")
+	if _, err := proxiedhandler.LoadEnv(nil); !errors.Is(err, proxyheaders.ErrConfigMustBeValid) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrConfigMustBeValid, err)
+	}
+	t.Setenv(proxiedhandler.EnvAllowedHosts, "")
+	//Any Front Door would be trusted.
+	t.Setenv(proxiedhandler.EnvPreset, "azure")
+	if _, err := proxiedhandler.LoadEnv(nil); !errors.Is(err, proxyheaders.ErrConfigMustBeValid) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrConfigMustBeValid, err)
+	}
+	t.Setenv(proxiedhandler.EnvPreset, "")
+	t.Setenv(proxiedhandler.EnvConfigFile, filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := proxiedhandler.LoadEnv(nil); !errors.Is(err, proxiedhandler.ErrConfigFileMustBeValid) {
+		t.Fatalf("want=%v, got=%v", proxiedhandler.ErrConfigFileMustBeValid, err)
+	}
+}
+
+func TestDumpConfig(t *testing.T) {
+	want := `preset.name: x-forwarded
+trusted_proxies: -
+allowed_hosts: -
+duplicate_headers: combine
+invalid_hops: reject
+client_cert.required: false
+client_cert.ca_files: -
+client_cert.crl_files: 0
+report_only: false
+serve_original: false
+pass_through_direct: false
+reloadable: false
+`
+	if got := proxiedhandler.DumpConfig(&proxiedhandler.ProxiedHandler{}); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if got := proxiedhandler.DumpConfig(nil); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	rl := &proxiedhandler.Reloadable{}
+	if err := rl.Store(&proxyheaders.Config{Preset: proxyheaders.AWSALB{Ranges: proxyheaders.NewPrefixSet(netip.MustParsePrefix("10.0.0.0/8"))}}); err != nil {
+		t.Fatal(err)
+	}
+	got := proxiedhandler.DumpConfig(&proxiedhandler.ProxiedHandler{Reloadable: rl})
+	for _, line := range []string{"preset.name: aws-alb\n", "preset.ranges: 10.0.0.0/8\n", "reloadable: true\n"} {
+		if !strings.Contains(got, line) {
+			t.Fatalf("want=%s, got=%s", line, got)
+		}
+	}
+
+	//The options of the preset.
+	got = proxiedhandler.DumpConfig(&proxiedhandler.ProxiedHandler{Config: &proxyheaders.Config{Preset: proxyheaders.NginxRealIP{
+		From:      proxyheaders.NewPrefixSet(netip.MustParsePrefix("10.0.0.0/8")),
+		Recursive: true,
+	}}})
+	for _, line := range []string{"preset.name: nginx\n", "preset.from: 10.0.0.0/8\n", "preset.header: -\n", "preset.recursive: true\n"} {
+		if !strings.Contains(got, line) {
+			t.Fatalf("want=%s, got=%s", line, got)
+		}
+	}
+	got = proxiedhandler.DumpConfig(&proxiedhandler.ProxiedHandler{Config: &proxyheaders.Config{Preset: proxyheaders.CDN{
+		ID:             "cdn",
+		ClientIPHeader: "X-Client-IP",
+		Required:       proxyheaders.FieldClientIP | proxyheaders.FieldProto,
+	}}})
+	for _, line := range []string{"preset.name: cdn\n", "preset.client_ip_header: X-Client-IP\n", "preset.client_cert_format: pem\n", "preset.required: ip proto\n"} {
+		if !strings.Contains(got, line) {
+			t.Fatalf("want=%s, got=%s", line, got)
+		}
+	}
+}
@@ -19,6 +19,7 @@ package proxiedhandler
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 
 	"gitlab.com/gopherburrow/proxyheaders"
@@ -26,7 +27,9 @@ import (
 
 //Some Constants used in namespaces and error strings.
 const (
-	ctxErrorValue = "gitlab.com/gopherburrow/proxyheaders/proxiedhandler Error"
+	ctxErrorValue      = "gitlab.com/gopherburrow/proxyheaders/proxiedhandler Error"
+	ctxViolationsValue = "gitlab.com/gopherburrow/proxyheaders/proxiedhandler Violations"
+	ctxTrustValue      = "gitlab.com/gopherburrow/proxyheaders/proxiedhandler Trust"
 )
 
 //Used in request contexts. Go suggests using a specific type different from string for context keys.
@@ -36,6 +39,12 @@ type ctxType string
 //So it is possible to retrieve it inside a ErrorHandler.
 var ctxError = ctxType(ctxErrorValue)
 
+//The key used to store the violations found in report only mode.
+var ctxViolations = ctxType(ctxViolationsValue)
+
+//The key used to store the trust level of the request.
+var ctxTrust = ctxType(ctxTrustValue)
+
 //ProxyHandler is a handler that process the, widely used in reverse proxies, headers X-Forwarded-*,
 //embed their values in a new request, remove the headers like it were generated without the proxy and,
 //if there is no errors, call the Handler.
@@ -47,11 +56,20 @@ var ctxError = ctxType(ctxErrorValue)
 //
 //The following headers are processed:
 //
-//• X-Forwarded-Host: translates to http.Request.Host [required];
+//• X-Forwarded-Host: translates to http.Request.Host and http.Request.URL.Host [required];
+//
+//• X-Forwarded-For: the client entry translates to http.Request.RemoteAddr. Invalid entries are errors or skipped, according
+//to the Config.InvalidHops policy [required];
+//
+//• X-Forwarded-Proto: translates to http.Request.URL.Scheme and to a default http.Request.TLS if the value is "https" or "wss".
+//Values other than "http", "https", "ws" and "wss" (case-insensitive) are errors [required];
+//
+//• X-Forwarded-Port: appended to http.Request.Host if not the default port of the protocol [optional];
 //
-//• X-Forwarded-For: translates to http.Request.RemoteAddr [required];
+//• X-Forwarded-Prefix: kept in the request context, see proxyheaders.ExternalURL [optional];
 //
-//• X-Forwarded-Proto: translates to a default http.Request.TLS if the value is "https", or simply do nothing if "http" [required];
+//• X-Forwarded-Tls-Version, X-Forwarded-Tls-Cipher, X-Forwarded-Tls-Sni and X-Forwarded-Tls-Alpn (or their X-SSL-* equivalents):
+//translate to http.Request.TLS Version, CipherSuite, ServerName and NegotiatedProtocol if the value of proto was "https" [optional];
 //
 //• X-Forwarded-Client-Cert: translates to parsed PEM X.509 Certificates in http.Request.TLS.PeerCertificates if the value of proto was "https" [optional].
 type ProxiedHandler struct {
@@ -63,24 +81,81 @@ type ProxiedHandler struct {
 	//It is possible to retrieve the error in the request with the request context value: .
 	//If nil, a vanilla "400 - Bad Request" will be served.
 	ErrorHandler http.Handler
+	//Config customizes the processing of the proxy headers.
+	//If nil, the same processing of proxyheaders.NewProxiedRequest is used.
+	Config *proxyheaders.Config
+	//Reloadable, if not nil, supplies the configuration instead of Config, so it can be replaced while serving.
+	//Config is used only while the Reloadable has no configuration yet.
+	Reloadable *Reloadable
+	//ReportOnly makes the handler never reject a request. Errors and policy violations (see proxyheaders.Config.ReportOnly) are
+	//reported to ViolationHandler and stored in the request context, retrievable with Violations, and the Handler is served anyway.
+	//It is meant to roll out stricter configurations without breaking traffic.
+	//The violations recorded by a Config with ReportOnly set are reported the same way, even if ReportOnly is not set here.
+	ReportOnly bool
+	//ServeOriginal, in report only mode, serves the Handler with the original request instead of the resolved one.
+	//The original request is always served when the headers cannot be resolved at all (eg: they are absent).
+	ServeOriginal bool
+	//ViolationHandler is called, in report only mode, for each violation found. It can be used to log or count them.
+	//If nil, the violations are logged in ErrorLog.
+	ViolationHandler func(r *http.Request, err error)
+	//ErrorLog logs the violations found in report only mode, when there is no ViolationHandler.
+	//If nil, the log package standard logger is used.
+	ErrorLog *log.Logger
+	//PassThroughDirect serves requests whose peer is not one of the Config.TrustedProxies (or the Config.Preset proxies) directly, as they came, instead of
+	//rejecting them. Forwarding headers they may have sent, the preset ones included, are removed, as they cannot be trusted (see
+	//proxyheaders.Config.StripHeaders). Use IsDirect to tell them apart.
+	//Requests from trusted proxies still must have valid headers.
+	//
+	//It is meant for services that receive both proxied and direct traffic (sidecars, health probes, etc).
+	//It has no effect if there are no trusted proxies, because then every peer is a trusted proxy.
+	PassThroughDirect bool
 }
 
 //ServeHTTP is the method that dispatches requests that came from proxies, transform the headers in the according http.Request fields,
 //and dispatches for the Handler or, in case of errors the ErrorHandler will be called.
 func (ph *ProxiedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ph.serve(w, r, ph.Handler)
+}
+
+//serve applies the handler policy to r and, if successful, serves next.
+func (ph *ProxiedHandler) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
 	//In case of no Handler defined a 404 Not Implemented will be served. It is not possible override this
 	//behavior because this is symply NOT THE OBJECTIVE of this handler.
-	if ph.Handler == nil {
+	if next == nil {
 		http.Error(w, fmt.Sprintf("%d - %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)), http.StatusNotFound)
 		return
 	}
 
+	//The configuration is read once, so a reload does not affect a request being served.
+	config := ph.config()
+
+	//Requests that did not come through a trusted proxy are served as direct requests, if allowed.
+	if ph.PassThroughDirect && !config.TrustedPeer(r) {
+		dr := r.Clone(r.Context())
+		trust := Direct
+		if config.StripHeaders(dr.Header) {
+			trust = UntrustedStripped
+		}
+		next.ServeHTTP(w, withTrust(dr, trust))
+		return
+	}
+
+	//In report only mode the Handler is always served.
+	if ph.ReportOnly {
+		ph.serveReportOnly(w, r, next, config)
+		return
+	}
+
 	//Tranlate the headers in request fields.
-	pr, err := proxyheaders.NewProxiedRequest(r)
+	pr, err := config.NewProxiedRequest(r)
 
-	//If there is no error simply serve the handler.
+	//If there is no error simply serve the handler, reporting the violations a report only Config may have recorded.
 	if err == nil {
-		ph.Handler.ServeHTTP(w, pr)
+		violations := proxyheaders.Violations(pr)
+		if len(violations) != 0 && ph.ServeOriginal {
+			pr = r
+		}
+		ph.report(w, r, pr, next, violations)
 		return
 	}
 
@@ -95,6 +170,59 @@ func (ph *ProxiedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+//config returns the current configuration of the Reloadable or, if there is none, Config.
+func (ph *ProxiedHandler) config() *proxyheaders.Config {
+	if c := ph.Reloadable.Config(); c != nil {
+		return c
+	}
+	return ph.Config
+}
+
+//serveReportOnly serves next with the resolved (or original) request, reporting any errors or violations instead of failing.
+func (ph *ProxiedHandler) serveReportOnly(w http.ResponseWriter, r *http.Request, next http.Handler, config *proxyheaders.Config) {
+	cfg := proxyheaders.Config{}
+	if config != nil {
+		cfg = *config
+	}
+	cfg.ReportOnly = true
+
+	pr, err := cfg.NewProxiedRequest(r)
+	var violations []error
+	if err != nil {
+		violations = []error{err}
+	} else {
+		violations = proxyheaders.Violations(pr)
+	}
+
+	out := pr
+	if err != nil || ph.ServeOriginal {
+		out = r
+	}
+	ph.report(w, r, out, next, violations)
+}
+
+//report serves next with out, trusted if there are no violations or, otherwise, partially trusted after reporting them to the
+//ViolationHandler or to the ErrorLog.
+func (ph *ProxiedHandler) report(w http.ResponseWriter, r, out *http.Request, next http.Handler, violations []error) {
+	if len(violations) == 0 {
+		next.ServeHTTP(w, withTrust(out, TrustedProxy))
+		return
+	}
+
+	logger := ph.ErrorLog
+	if logger == nil {
+		logger = log.Default()
+	}
+	for _, v := range violations {
+		if ph.ViolationHandler != nil {
+			ph.ViolationHandler(r, v)
+			continue
+		}
+		logger.Printf("proxiedhandler: report only: %s %s from %s: %v", r.Method, r.URL.RequestURI(), r.RemoteAddr, v)
+	}
+	next.ServeHTTP(w, withTrust(out.WithContext(context.WithValue(out.Context(), ctxViolations, violations)), PartiallyTrusted))
+}
+
 //Error retrieves the proxy parsing error, when inside XForwardedHandler.ErrorHandler.
 //If called outside an XForwardedHandler.ErrorHandler it will retun nil.
 func Error(r *http.Request) error {
@@ -104,3 +232,19 @@ func Error(r *http.Request) error {
 	}
 	return m
 }
+
+//Violations retrieves the errors and policy violations found in report only mode, when inside ProxiedHandler.Handler.
+//If there are none, or the handler is not in report only mode, it returns nil.
+func Violations(r *http.Request) []error {
+	v, ok := r.Context().Value(ctxViolations).([]error)
+	if !ok {
+		return nil
+	}
+	return append([]error(nil), v...)
+}
+
+//IsDirect reports if the request was served directly, without a trusted proxy, because of ProxiedHandler.PassThroughDirect.
+func IsDirect(r *http.Request) bool {
+	t := Trust(r)
+	return t == Direct || t == UntrustedStripped
+}
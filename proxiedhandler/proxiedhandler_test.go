@@ -17,9 +17,11 @@
 package proxiedhandler_test
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 
 	"gitlab.com/gopherburrow/proxyheaders"
@@ -369,3 +371,286 @@ func TestProxiedHandler_GetError_failCalledOutsideErrorHandler(t *testing.T) {
 		t.Fatalf("want=%d, got=%d", want, got)
 	}
 }
+
+func TestProxiedHandler_ServeHTTP_failDuplicateHeaderWithConfig(t *testing.T) {
+	xfh := &proxiedhandler.ProxiedHandler{
+		Handler:      http.HandlerFunc(DumpServeHTTP),
+		ErrorHandler: http.HandlerFunc(ErrorHandlerFunc),
+		Config:       &proxyheaders.Config{DuplicateHeaders: proxyheaders.DuplicateReject},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-For", "5.6.7.8")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+
+	rr := httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := http.StatusBadRequest, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := (&proxyheaders.DuplicateHeaderError{Header: "X-Forwarded-For", Values: []string{"1.2.3.4", "5.6.7.8"}}).Error(), rr.Body.String(); want != got {
+		t.Fatalf("want=%q, got=%q", want, got)
+	}
+}
+
+func TestProxiedHandler_ServeHTTP_reportOnly(t *testing.T) {
+	var reported []error
+	var served *http.Request
+	xfh := &proxiedhandler.ProxiedHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = r
+			DumpServeHTTP(w, r)
+		}),
+		Config:           &proxyheaders.Config{AllowedHosts: []string{"www.example.com"}},
+		ReportOnly:       true,
+		ViolationHandler: func(r *http.Request, err error) { reported = append(reported, err) },
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "evil.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+
+	rr := httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := http.StatusOK, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := 1, len(reported); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if !errors.Is(reported[0], proxyheaders.ErrHostMustBeAllowed) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrHostMustBeAllowed, reported[0])
+	}
+	if want, got := "evil.example.com", served.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := 1, len(proxiedhandler.Violations(served)); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	//Serving the original request.
+	reported, served = nil, nil
+	xfh.ServeOriginal = true
+	rr = httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := http.StatusOK, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := "localhost:8080", served.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := 1, len(proxiedhandler.Violations(served)); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	//Headers that cannot be resolved are also reported, serving the original request.
+	reported, served = nil, nil
+	xfh.ServeOriginal = false
+	req.Header.Del("X-Forwarded-For")
+	rr = httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := http.StatusOK, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := proxyheaders.ErrMustHaveXForwardedFor, reported[0]; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "localhost:8080", served.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//Without violations nothing is reported.
+	reported, served = nil, nil
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Set("X-Forwarded-Host", "www.example.com")
+	rr = httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := 0, len(reported); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := 0, len(proxiedhandler.Violations(served)); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+}
+
+func TestProxiedHandler_ServeHTTP_configReportOnly(t *testing.T) {
+	var reported []error
+	var served *http.Request
+	xfh := &proxiedhandler.ProxiedHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = r
+			DumpServeHTTP(w, r)
+		}),
+		Config: &proxyheaders.Config{
+			ReportOnly:     true,
+			TrustedProxies: proxyheaders.NewPrefixSet(netip.MustParsePrefix("10.0.0.0/8")),
+		},
+		ViolationHandler: func(r *http.Request, err error) { reported = append(reported, err) },
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "evil")
+	req.Header.Add("X-Forwarded-Proto", "https")
+
+	rr := httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := http.StatusOK, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := 1, len(reported); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if !errors.Is(reported[0], proxyheaders.ErrProxyMustBeTrusted) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrProxyMustBeTrusted, reported[0])
+	}
+	if want, got := proxiedhandler.PartiallyTrusted, proxiedhandler.Trust(served); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := 1, len(proxiedhandler.Violations(served)); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	//Serving the original request.
+	reported, served = nil, nil
+	xfh.ServeOriginal = true
+	rr = httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := "localhost:8080", served.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := proxiedhandler.PartiallyTrusted, proxiedhandler.Trust(served); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+
+	//From a trusted proxy nothing is reported.
+	reported, served = nil, nil
+	req.RemoteAddr = "10.0.0.1:1234"
+	rr = httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := 0, len(reported); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := proxiedhandler.TrustedProxy, proxiedhandler.Trust(served); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "evil", served.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+}
+
+func TestProxiedHandler_ServeHTTP_passThroughDirect(t *testing.T) {
+	var served *http.Request
+	xfh := &proxiedhandler.ProxiedHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = r
+			DumpServeHTTP(w, r)
+		}),
+		Config:            &proxyheaders.Config{TrustedProxies: proxyheaders.NewPrefixSet(netip.MustParsePrefix("10.0.0.0/8"))},
+		PassThroughDirect: true,
+	}
+
+	//A direct probe, without headers.
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/healthz", nil)
+	req.RemoteAddr = "192.168.0.10:4321"
+	rr := httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := http.StatusOK, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := true, proxiedhandler.IsDirect(served); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+	if want, got := "192.168.0.10:4321", served.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	//A direct request with forged headers.
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	rr = httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := http.StatusOK, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := "", served.Header.Get("X-Forwarded-For"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "1.2.3.4", req.Header.Get("X-Forwarded-For"); want != got {
+		t.Fatalf("original request modified: want=%s, got=%s", want, got)
+	}
+
+	//A proxied request must have valid headers.
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "10.0.0.1:4321"
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	rr = httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := http.StatusBadRequest, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	rr = httptest.NewRecorder()
+	xfh.ServeHTTP(rr, req)
+	if want, got := http.StatusOK, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := false, proxiedhandler.IsDirect(served); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+}
+
+//Every preset with headers of its own, that a direct client could forge.
+func TestProxiedHandler_ServeHTTP_passThroughDirectPresetHeaders(t *testing.T) {
+	for _, name := range []string{"cloudflare", "aws-alb", "envoy", "haproxy", "azure", "google", "fastly", "akamai", "heroku", "fly", "render", "vercel"} {
+		preset, err := proxyheaders.PresetByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var served *http.Request
+		xfh := &proxiedhandler.ProxiedHandler{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = r
+				DumpServeHTTP(w, r)
+			}),
+			Config: &proxyheaders.Config{
+				TrustedProxies: proxyheaders.NewPrefixSet(netip.MustParsePrefix("10.0.0.0/8")),
+				Preset:         preset,
+			},
+			PassThroughDirect: true,
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.RemoteAddr = "192.168.0.10:4321"
+		for _, h := range preset.Headers() {
+			req.Header.Add(h, "forged")
+		}
+		rr := httptest.NewRecorder()
+		xfh.ServeHTTP(rr, req)
+		if want, got := http.StatusOK, rr.Code; want != got {
+			t.Fatalf("%s: want=%d, got=%d", name, want, got)
+		}
+		if want, got := proxiedhandler.UntrustedStripped, proxiedhandler.Trust(served); want != got {
+			t.Fatalf("%s: want=%v, got=%v", name, want, got)
+		}
+		for _, h := range preset.Headers() {
+			if want, got := "", served.Header.Get(h); want != got {
+				t.Fatalf("%s: %s: want=%s, got=%s", name, h, want, got)
+			}
+		}
+
+		//Only a preset header is enough to be stripped.
+		req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.RemoteAddr = "192.168.0.10:4321"
+		req.Header.Add(preset.Headers()[0], "forged")
+		xfh.ServeHTTP(httptest.NewRecorder(), req)
+		if want, got := proxiedhandler.UntrustedStripped, proxiedhandler.Trust(served); want != got {
+			t.Fatalf("%s: want=%v, got=%v", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxiedhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+//ErrReloadableMustHaveLoad is returned by Reloadable.Reload when there is no Load function.
+var ErrReloadableMustHaveLoad = errors.New("proxiedhandler: reloadable must have a Load function")
+
+//DefaultWatchInterval is the interval Reloadable.WatchFile checks the file at when none is informed.
+const DefaultWatchInterval = 5 * time.Second
+
+//Reloadable holds a proxyheaders.Config that can be replaced while requests are being served, changing the trusted proxies,
+//the preset, the allowed hosts, the client CAs and CRLs, etc, without a redeploy.
+//
+//The configuration is replaced as a whole, with an atomic swap, so a request always sees a consistent configuration and
+//reading it takes no locks. A new configuration is validated with proxyheaders.Config.Validate before it goes live; if it is
+//invalid (or cannot be loaded) the current one is kept.
+//
+//A reload can be triggered by calling Reload (eg: from an admin endpoint), by a signal (ReloadOnSignal) or by changes in a
+//file (WatchFile). Use it in ProxiedHandler.Reloadable.
+//
+//A configuration must not be modified after it is stored.
+type Reloadable struct {
+	//Load builds a new configuration, eg: reading a file. It is called by Reload.
+	Load func() (*proxyheaders.Config, error)
+	//ErrorLog logs the reloads triggered by ReloadOnSignal and WatchFile that failed.
+	//If nil, the log package standard logger is used.
+	ErrorLog *log.Logger
+
+	//config is the current configuration.
+	config atomic.Pointer[proxyheaders.Config]
+	//mu serializes the reloads and stores, so an older configuration cannot replace a newer one.
+	mu sync.Mutex
+}
+
+//NewReloadable returns a Reloadable with the configuration returned by load, or an error if it cannot be loaded or is invalid.
+func NewReloadable(load func() (*proxyheaders.Config, error)) (*Reloadable, error) {
+	rl := &Reloadable{Load: load}
+	if err := rl.Reload(); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+//Config returns the current configuration, or nil if there is none yet. A nil rl has no configuration.
+func (rl *Reloadable) Config() *proxyheaders.Config {
+	if rl == nil {
+		return nil
+	}
+	return rl.config.Load()
+}
+
+//Store validates c and, if it is valid, makes it the current configuration. It waits for a Reload in progress, so the
+//configuration it loads does not replace c.
+func (rl *Reloadable) Store(c *proxyheaders.Config) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.store(c)
+}
+
+//store validates c and, if it is valid, makes it the current configuration. It must be called with mu locked.
+func (rl *Reloadable) store(c *proxyheaders.Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c == nil {
+		c = &proxyheaders.Config{}
+	}
+	rl.config.Store(c)
+	return nil
+}
+
+//Reload calls Load and stores the new configuration. In case of error the current configuration is kept.
+func (rl *Reloadable) Reload() error {
+	if rl.Load == nil {
+		return ErrReloadableMustHaveLoad
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	c, err := rl.Load()
+	if err != nil {
+		return fmt.Errorf("proxiedhandler: cannot load configuration: %w", err)
+	}
+	return rl.store(c)
+}
+
+//ReloadOnSignal reloads the configuration each time one of the signals is received, until ctx is done.
+//If no signal is informed, SIGHUP is used (where there is one). It returns immediately, the signals are handled in a new goroutine.
+func (rl *Reloadable) ReloadOnSignal(ctx context.Context, sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = reloadSignals
+	}
+	if len(sig) == 0 {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				rl.reload()
+			}
+		}
+	}()
+}
+
+//WatchFile reloads the configuration when the modification time or the size of the file at path changes, checking it
+//every interval, until ctx is done. It returns immediately, the file is polled in a new goroutine.
+//If interval is zero or negative, DefaultWatchInterval is used.
+//
+//The file is only watched, it is up to Load to read it.
+func (rl *Reloadable) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	last, _ := os.Stat(path)
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				//A file being replaced may be missing for a moment, it is checked again in the next tick.
+				continue
+			}
+			if last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+				continue
+			}
+			last = fi
+			rl.reload()
+		}
+	}()
+}
+
+//reload calls Reload, logging the error.
+func (rl *Reloadable) reload() {
+	if err := rl.Reload(); err != nil {
+		logger := rl.ErrorLog
+		if logger == nil {
+			logger = log.Default()
+		}
+		logger.Printf("proxiedhandler: reload: %v", err)
+	}
+}
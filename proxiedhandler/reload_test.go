@@ -0,0 +1,208 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxiedhandler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+	"gitlab.com/gopherburrow/proxyheaders/proxiedhandler"
+)
+
+//waitAllowedHost waits for the configuration of rl to allow only host.
+func waitAllowedHost(t *testing.T, rl *proxiedhandler.Reloadable, host string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if c := rl.Config(); c != nil && len(c.AllowedHosts) == 1 && c.AllowedHosts[0] == host {
+			return
+		}
+	}
+	t.Fatalf("want=%s, got=%v", host, rl.Config().AllowedHosts)
+}
+
+func TestReloadable(t *testing.T) {
+	host := "www.example.com"
+	var loadErr error
+	rl, err := proxiedhandler.NewReloadable(func() (*proxyheaders.Config, error) {
+		return &proxyheaders.Config{AllowedHosts: []string{host}}, loadErr
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ph := &proxiedhandler.ProxiedHandler{Handler: http.HandlerFunc(DumpServeHTTP), Reloadable: rl}
+	serve := func(host string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", host)
+		req.Header.Add("X-Forwarded-Proto", "https")
+		rr := httptest.NewRecorder()
+		ph.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if want, got := http.StatusOK, serve("www.example.com"); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	host = "api.example.com"
+	if err := rl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := http.StatusBadRequest, serve("www.example.com"); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := http.StatusOK, serve("api.example.com"); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	//Configurations that cannot be loaded or are invalid do not replace the current one.
+	loadErr = errors.New("boom")
+	if err := rl.Reload(); !errors.Is(err, loadErr) {
+		t.Fatalf("want=%v, got=%v", loadErr, err)
+	}
+	loadErr, host = nil, "www.example.com:443"
+	if err := rl.Reload(); !errors.Is(err, proxyheaders.ErrConfigMustBeValid) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrConfigMustBeValid, err)
+	}
+	if want, got := http.StatusOK, serve("api.example.com"); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	if err := rl.Store(&proxyheaders.Config{AllowedHosts: []string{"*"}}); !errors.Is(err, proxyheaders.ErrConfigMustBeValid) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrConfigMustBeValid, err)
+	}
+	if err := rl.Store(nil); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := http.StatusOK, serve("www.example.com"); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	if _, err := proxiedhandler.NewReloadable(func() (*proxyheaders.Config, error) { return nil, errors.New("boom") }); err == nil {
+		t.Fatal("want!=nil, got=nil")
+	}
+	if want, got := proxiedhandler.ErrReloadableMustHaveLoad, (&proxiedhandler.Reloadable{}).Reload(); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestReloadable_storeDuringReload(t *testing.T) {
+	loading, release := make(chan struct{}), make(chan struct{})
+	older := &proxyheaders.Config{AllowedHosts: []string{"older.example.com"}}
+	rl := &proxiedhandler.Reloadable{Load: func() (*proxyheaders.Config, error) {
+		close(loading)
+		<-release
+		return older, nil
+	}}
+	reloaded := make(chan error)
+	go func() { reloaded <- rl.Reload() }()
+	<-loading
+
+	//The store waits for the reload in progress, so the configuration it loaded does not replace the stored one.
+	newer := &proxyheaders.Config{AllowedHosts: []string{"newer.example.com"}}
+	stored := make(chan error)
+	go func() { stored <- rl.Store(newer) }()
+	select {
+	case <-stored:
+		t.Fatal("want=store after reload, got=store during reload")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-reloaded; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-stored; err != nil {
+		t.Fatal(err)
+	}
+	if want, got := newer, rl.Config(); want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestReloadable_WatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("www.example.com"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rl, err := proxiedhandler.NewReloadable(func() (*proxyheaders.Config, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return &proxyheaders.Config{AllowedHosts: []string{strings.TrimSpace(string(b))}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rl.WatchFile(ctx, path, 10*time.Millisecond)
+
+	if err := os.WriteFile(path, []byte("api.example.com"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitAllowedHost(t, rl, "api.example.com")
+
+	//Without an interval the default one is used, instead of panicking.
+	rl.WatchFile(ctx, path, 0)
+}
+
+func TestReloadable_ReloadOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent to the process on windows")
+	}
+	var host atomic.Value
+	host.Store("www.example.com")
+	reloaded := make(chan struct{}, 1)
+	rl, err := proxiedhandler.NewReloadable(func() (*proxyheaders.Config, error) {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+		return &proxyheaders.Config{AllowedHosts: []string{host.Load().(string)}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-reloaded
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rl.ReloadOnSignal(ctx, os.Interrupt)
+
+	host.Store("api.example.com")
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want=reload, got=timeout")
+	}
+	waitAllowedHost(t, rl, "api.example.com")
+}
@@ -0,0 +1,107 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxiedhandler
+
+import (
+	"fmt"
+	"net/http"
+)
+
+//Router applies a different ProxiedHandler policy to each route of a service, like requiring a verified client certificate
+//in "/admin/", forwarding headers in "/api/" and bypassing everything in "/healthz".
+//
+//Routes are http.ServeMux patterns (eg: "/api/", "GET /admin/{path...}", "/healthz"), with the same precedence rules. They
+//are matched against the request as received from the proxy, before the headers are processed. Requests the http.ServeMux
+//would redirect, with unclean paths or without the trailing slash of a route, are redirected instead of served by Default. Method and wildcard patterns
+//need the Go 1.22 http.ServeMux (not disabled by GODEBUG=httpmuxgo121=1).
+//
+//Routes must be registered before the Router starts serving requests.
+type Router struct {
+	//Handler is served after the route policy is applied, unless the policy has its own Handler.
+	//If nil, a vanilla "404 - Not Found" will be served.
+	Handler http.Handler
+	//Default is the policy of requests that match no route. If nil, a ProxiedHandler with no Config is used.
+	Default *ProxiedHandler
+
+	mux *http.ServeMux
+}
+
+//route is the http.Handler registered in the mux for each pattern. It is never served, only matched.
+type route struct {
+	//policy is nil for bypassed routes.
+	policy *ProxiedHandler
+}
+
+//ServeHTTP is only needed to register a route in http.ServeMux.
+func (rt *route) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+//Handle registers the policy for requests matching pattern. The policy Handler, if nil, defaults to the Router Handler.
+//
+//Like http.ServeMux.Handle, it panics if pattern is invalid or conflicts with another one.
+func (rt *Router) Handle(pattern string, policy *ProxiedHandler) {
+	if policy == nil {
+		panic("proxiedhandler: nil policy, use Bypass")
+	}
+	rt.handle(pattern, &route{policy: policy})
+}
+
+//Bypass registers pattern as a route where the request is served by the Router Handler as it came, without any processing.
+func (rt *Router) Bypass(pattern string) {
+	rt.handle(pattern, &route{})
+}
+
+//handle registers rte in the mux.
+func (rt *Router) handle(pattern string, rte *route) {
+	if rt.mux == nil {
+		rt.mux = http.NewServeMux()
+	}
+	rt.mux.Handle(pattern, rte)
+}
+
+//ServeHTTP selects the policy of the route matching r and applies it.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	policy := rt.Default
+	if policy == nil {
+		policy = &ProxiedHandler{}
+	}
+	if rt.mux != nil {
+		h, pattern := rt.mux.Handler(r)
+		if rte, ok := h.(*route); ok {
+			policy = rte.policy
+		} else if pattern != "" {
+			//The mux redirects unclean paths ("/admin//x", "/healthz/../admin/x") and paths without the trailing slash of a
+			//route ("/admin"). They must not be served by the Default policy, the redirected request gets the route one.
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	//Bypassed routes.
+	if policy == nil {
+		if rt.Handler == nil {
+			http.Error(w, fmt.Sprintf("%d - %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)), http.StatusNotFound)
+			return
+		}
+		rt.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	next := policy.Handler
+	if next == nil {
+		next = rt.Handler
+	}
+	policy.serve(w, r, next)
+}
@@ -0,0 +1,140 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+//Method and wildcard patterns need the Go 1.22 http.ServeMux, even when built without a go.mod.
+
+//go:debug httpmuxgo121=0
+package proxiedhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+	"gitlab.com/gopherburrow/proxyheaders/proxiedhandler"
+)
+
+func TestRouter_ServeHTTP(t *testing.T) {
+	var served *http.Request
+	rt := &proxiedhandler.Router{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = r
+			DumpServeHTTP(w, r)
+		}),
+	}
+	rt.Handle("/admin/", &proxiedhandler.ProxiedHandler{
+		Config:       &proxyheaders.Config{RequireClientCert: true},
+		ErrorHandler: http.HandlerFunc(ErrorHandlerFunc),
+	})
+	rt.Handle("GET /reports/{id}", &proxiedhandler.ProxiedHandler{ReportOnly: true, ViolationHandler: func(*http.Request, error) {}})
+	rt.Bypass("/healthz")
+
+	tests := []struct {
+		method, path string
+		headers      bool
+		cert         bool
+		code         int
+		host         string
+	}{
+		//Default policy: forwarded headers are required.
+		{http.MethodGet, "/api/users", true, false, http.StatusOK, "www.example.com"},
+		{http.MethodGet, "/api/users", false, false, http.StatusBadRequest, ""},
+		//Admin requires a client certificate.
+		{http.MethodGet, "/admin/users", true, false, http.StatusBadRequest, ""},
+		{http.MethodGet, "/admin/users", true, true, http.StatusOK, "www.example.com"},
+		//Reports only reports, for GET.
+		{http.MethodGet, "/reports/1", false, false, http.StatusOK, "localhost:8080"},
+		{http.MethodPost, "/reports/1", false, false, http.StatusBadRequest, ""},
+		//Health checks bypass everything.
+		{http.MethodGet, "/healthz", false, false, http.StatusOK, "localhost:8080"},
+		{http.MethodGet, "/healthz", true, false, http.StatusOK, "localhost:8080"},
+	}
+	for _, tt := range tests {
+		served = nil
+		req := httptest.NewRequest(tt.method, "http://localhost:8080"+tt.path, nil)
+		if tt.headers {
+			req.Header.Add("X-Forwarded-For", "1.2.3.4")
+			req.Header.Add("X-Forwarded-Host", "www.example.com")
+			req.Header.Add("X-Forwarded-Proto", "https")
+		}
+		if tt.cert {
+			req.Header.Add("X-Forwarded-Client-Cert", validCert)
+		}
+		rr := httptest.NewRecorder()
+		rt.ServeHTTP(rr, req)
+		if want, got := tt.code, rr.Code; want != got {
+			t.Fatalf("%s %s: want=%d, got=%d", tt.method, tt.path, want, got)
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		if want, got := tt.host, served.Host; want != got {
+			t.Fatalf("%s %s: want=%s, got=%s", tt.method, tt.path, want, got)
+		}
+	}
+}
+
+func TestRouter_ServeHTTP_policyHandlerAndDefault(t *testing.T) {
+	rt := &proxiedhandler.Router{
+		Default: &proxiedhandler.ProxiedHandler{ReportOnly: true, ViolationHandler: func(*http.Request, error) {}},
+	}
+	rt.Handle("/own/", &proxiedhandler.ProxiedHandler{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusAccepted) }),
+	})
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/own/x", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	rt.ServeHTTP(rr, req)
+	if want, got := http.StatusAccepted, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	//No Router Handler.
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/other", nil)
+	rt.ServeHTTP(rr, req)
+	if want, got := http.StatusNotFound, rr.Code; want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+}
+
+func TestRouter_ServeHTTP_redirect(t *testing.T) {
+	rt := &proxiedhandler.Router{Handler: http.HandlerFunc(DumpServeHTTP)}
+	rt.Handle("/admin/", &proxiedhandler.ProxiedHandler{Config: &proxyheaders.Config{RequireClientCert: true}})
+	rt.Bypass("/healthz")
+
+	for path, location := range map[string]string{
+		"/admin//x":           "/admin/x",
+		"/healthz/../admin/x": "/admin/x",
+		"/admin":              "/admin/",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+path, nil)
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", "www.example.com")
+		req.Header.Add("X-Forwarded-Proto", "https")
+		rr := httptest.NewRecorder()
+		rt.ServeHTTP(rr, req)
+		if want, got := 3, rr.Code/100; want != got {
+			t.Fatalf("%s: want=3xx, got=%d", path, rr.Code)
+		}
+		if want, got := location, rr.Header().Get("Location"); want != got {
+			t.Fatalf("%s: want=%s, got=%s", path, want, got)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxiedhandler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+//TrustLevel classifies how much the values of a request served by ProxiedHandler can be trusted.
+//
+//It complements proxyheaders.AssertedFields, that tells which fields had their values asserted by the proxy.
+//Eg: a handler can accept the forwarded client certificate only if the level is TrustedProxy and the fields have
+//proxyheaders.FieldClientCert.
+type TrustLevel int
+
+const (
+	//TrustUnknown is the level of requests not served by a ProxiedHandler.
+	TrustUnknown TrustLevel = iota
+	//Direct is a request that did not come through a trusted proxy and had no forwarding headers (see PassThroughDirect).
+	//Its values were observed by this server.
+	Direct
+	//TrustedProxy is a request that came from a trusted proxy, with all the headers and policies satisfied.
+	TrustedProxy
+	//PartiallyTrusted is a request served in report only mode despite errors or policy violations (see ReportOnly and
+	//proxyheaders.Config.ReportOnly), so some
+	//of its values, or the proxy itself, could not be trusted.
+	PartiallyTrusted
+	//UntrustedStripped is a request that did not come through a trusted proxy, but had forwarding headers that were removed
+	//(see PassThroughDirect). Its values were observed by this server, but the peer tried to assert others.
+	UntrustedStripped
+)
+
+//String returns the level name.
+func (t TrustLevel) String() string {
+	switch t {
+	case TrustUnknown:
+		return "unknown"
+	case Direct:
+		return "direct"
+	case TrustedProxy:
+		return "trusted-proxy"
+	case PartiallyTrusted:
+		return "partially-trusted"
+	case UntrustedStripped:
+		return "untrusted-stripped"
+	}
+	return fmt.Sprintf("TrustLevel(%d)", int(t))
+}
+
+//withTrust returns r with the trust level in its context.
+func withTrust(r *http.Request, t TrustLevel) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ctxTrust, t))
+}
+
+//Trust retrieves the trust level of a request, when inside ProxiedHandler.Handler.
+//If called outside a ProxiedHandler.Handler it will return TrustUnknown.
+func Trust(r *http.Request) TrustLevel {
+	t, _ := r.Context().Value(ctxTrust).(TrustLevel)
+	return t
+}
@@ -0,0 +1,118 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxiedhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+	"gitlab.com/gopherburrow/proxyheaders/proxiedhandler"
+)
+
+func TestTrust(t *testing.T) {
+	var trust proxiedhandler.TrustLevel
+	var fields proxyheaders.Field
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trust, fields = proxiedhandler.Trust(r), proxyheaders.AssertedFields(r)
+		DumpServeHTTP(w, r)
+	})
+	trusted := proxyheaders.NewPrefixSet(netip.MustParsePrefix("10.0.0.0/8"))
+
+	tests := []struct {
+		name    string
+		ph      *proxiedhandler.ProxiedHandler
+		peer    string
+		headers bool
+		cert    bool
+		trust   proxiedhandler.TrustLevel
+		fields  proxyheaders.Field
+	}{
+		{
+			name:    "trusted proxy",
+			ph:      &proxiedhandler.ProxiedHandler{Config: &proxyheaders.Config{TrustedProxies: trusted}},
+			peer:    "10.0.0.1:1234",
+			headers: true,
+			trust:   proxiedhandler.TrustedProxy,
+			fields:  proxyheaders.FieldClientIP | proxyheaders.FieldHost | proxyheaders.FieldProto,
+		},
+		{
+			name:    "trusted proxy with cert",
+			ph:      &proxiedhandler.ProxiedHandler{},
+			peer:    "10.0.0.1:1234",
+			headers: true,
+			cert:    true,
+			trust:   proxiedhandler.TrustedProxy,
+			fields:  proxyheaders.FieldClientIP | proxyheaders.FieldHost | proxyheaders.FieldProto | proxyheaders.FieldClientCert,
+		},
+		{
+			name:  "direct",
+			ph:    &proxiedhandler.ProxiedHandler{Config: &proxyheaders.Config{TrustedProxies: trusted}, PassThroughDirect: true},
+			peer:  "192.168.0.1:1234",
+			trust: proxiedhandler.Direct,
+		},
+		{
+			name:    "untrusted stripped",
+			ph:      &proxiedhandler.ProxiedHandler{Config: &proxyheaders.Config{TrustedProxies: trusted}, PassThroughDirect: true},
+			peer:    "192.168.0.1:1234",
+			headers: true,
+			trust:   proxiedhandler.UntrustedStripped,
+		},
+		{
+			name: "partially trusted",
+			ph: &proxiedhandler.ProxiedHandler{
+				Config:           &proxyheaders.Config{TrustedProxies: trusted},
+				ReportOnly:       true,
+				ViolationHandler: func(*http.Request, error) {},
+			},
+			peer:    "192.168.0.1:1234",
+			headers: true,
+			trust:   proxiedhandler.PartiallyTrusted,
+			fields:  proxyheaders.FieldClientIP | proxyheaders.FieldHost | proxyheaders.FieldProto,
+		},
+	}
+	for _, tt := range tests {
+		trust, fields = proxiedhandler.TrustUnknown, 0
+		tt.ph.Handler = handler
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.RemoteAddr = tt.peer
+		if tt.headers {
+			req.Header.Add("X-Forwarded-For", "1.2.3.4")
+			req.Header.Add("X-Forwarded-Host", "www.example.com")
+			req.Header.Add("X-Forwarded-Proto", "https")
+		}
+		if tt.cert {
+			req.Header.Add("X-Forwarded-Client-Cert", validCert)
+		}
+		rr := httptest.NewRecorder()
+		tt.ph.ServeHTTP(rr, req)
+		if want, got := http.StatusOK, rr.Code; want != got {
+			t.Fatalf("%s: want=%d, got=%d", tt.name, want, got)
+		}
+		if want, got := tt.trust, trust; want != got {
+			t.Fatalf("%s: want=%s, got=%s", tt.name, want, got)
+		}
+		if want, got := tt.fields, fields; want != got {
+			t.Fatalf("%s: want=%s, got=%s", tt.name, want, got)
+		}
+	}
+
+	if want, got := proxiedhandler.TrustUnknown, proxiedhandler.Trust(httptest.NewRequest(http.MethodGet, "/", nil)); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+}
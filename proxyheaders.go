@@ -17,10 +17,10 @@
 package proxyheaders
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
+	"fmt"
 	"net/http"
 )
 
@@ -36,70 +36,220 @@ var (
 	ErrMustHaveXForwardedHost = errors.New("proxyheaders: must have X-Forwarded-Host in headers")
 	//ErrMustHaveXForwardedProto is returned when the X-Forwarded-Proto header is not present.
 	ErrMustHaveXForwardedProto = errors.New("proxyheaders: must have X-Forwarded-Proto in headers")
-	//ErrMustHaveXForwardedProto is returned when the X-Forwarded-Proto header is present, but has an invalid certificate value.
+	//ErrXForwardedProtoMustBeValid is returned when the X-Forwarded-Proto header is present, but it is not one of "http", "https", "ws" or "wss".
+	//The actual error returned is a *ProtoError, that matches this error using errors.Is.
+	ErrXForwardedProtoMustBeValid = errors.New("proxyheaders: X-Forwarded-Proto must be http, https, ws or wss")
+	//ErrXForwardedPortMustBeValid is returned when the X-Forwarded-Port header is present, but it is not a port number between 1 and 65535.
+	ErrXForwardedPortMustBeValid = errors.New("proxyheaders: X-Forwarded-Port must be a number between 1 and 65535")
+	//ErrXForwardedPrefixMustBeValid is returned when the X-Forwarded-Prefix header is present, but it is not an absolute path
+	//without query or fragment.
+	ErrXForwardedPrefixMustBeValid = errors.New("proxyheaders: X-Forwarded-Prefix must be an absolute path")
+	//ErrTLSVersionMustBeValid is returned when the TLS version informed by the proxy (X-Forwarded-Tls-Version or X-SSL-Protocol)
+	//is not a known protocol version.
+	ErrTLSVersionMustBeValid = errors.New("proxyheaders: TLS version informed by the proxy is unknown")
+	//ErrTLSCipherSuiteMustBeValid is returned when the cipher suite informed by the proxy (X-Forwarded-Tls-Cipher or X-SSL-Cipher)
+	//is not a known OpenSSL or IANA cipher suite name.
+	ErrTLSCipherSuiteMustBeValid = errors.New("proxyheaders: TLS cipher suite informed by the proxy is unknown")
+	//ErrHeaderMustNotBeDuplicated is returned when a header is repeated in more than one line and the Config.DuplicateHeaders
+	//policy does not allow it. The actual error returned is a *DuplicateHeaderError, that matches this error using errors.Is.
+	ErrHeaderMustNotBeDuplicated = errors.New("proxyheaders: header must not be repeated")
+	//ErrXForwardedForMustBeValid is returned when an entry of the X-Forwarded-For header is not an IP address (with optional port),
+	//an obfuscated identifier or "unknown". The actual error returned is a *HopError, that matches this error using errors.Is.
+	ErrXForwardedForMustBeValid = errors.New("proxyheaders: X-Forwarded-For entries must be valid addresses")
+	//ErrProxyMustBeTrusted is returned when Config.TrustedProxies (or the Preset proxies) are set and the request did not come
+	//from one of them.
+	ErrProxyMustBeTrusted = errors.New("proxyheaders: request must come from a trusted proxy")
+	//ErrHostMustBeAllowed is returned when Config.AllowedHosts is set and the host (forwarded or, if none, the request Host)
+	//is not one of them. The actual error returned wraps this one, with the offending host.
+	ErrHostMustBeAllowed = errors.New("proxyheaders: host must be an allowed host")
+	//ErrMustHaveXForwardedClientCert is returned when Config.RequireClientCert is set and the X-Forwarded-Client-Cert header is not
+	//present, or the protocol is not secure.
+	ErrMustHaveXForwardedClientCert = errors.New("proxyheaders: must have X-Forwarded-Client-Cert in headers")
+	//ErrXForwardedClientCertMustBeVerified is returned when Config.ClientCAs is set and the forwarded client certificate
+	//cannot be verified against it, or the proxy asserted a client identity without the certificate. The actual error returned wraps this one, with the verification failure.
+	ErrXForwardedClientCertMustBeVerified = errors.New("proxyheaders: X-Forwarded-Client-Cert must be verified by the client CAs")
+	//ErrXForwardedClientCertMustNotBeRevoked is returned when Config.ClientCRLs is set and a certificate of the verified chain
+	//is listed in the CRL of its issuer. The actual error returned wraps this one, with the revoked certificate.
+	ErrXForwardedClientCertMustNotBeRevoked = errors.New("proxyheaders: X-Forwarded-Client-Cert must not be revoked")
+	//ErrConfigMustBeValid is returned by Config.Validate when the configuration is inconsistent. The actual error returned
+	//wraps this one, with the problem found.
+	ErrConfigMustBeValid = errors.New("proxyheaders: configuration must be valid")
+	//ErrXForwardedClientCertMustBeValid is returned when the X-Forwarded-Client-Cert header is present, but has an invalid certificate value.
 	ErrXForwardedClientCertMustBeValid = errors.New("proxyheaders: cannot parse the PEM encoded X.509 certificates in X-Forwarded-Client-Cert header")
 )
 
 //NewProxiedRequest process the headers X-Forwarded-*, embed their values in a new request copied from r and return it, handling the errors.
+//
+//The X-Forwarded-Proto is matched case-insensitively against "http", "https", "ws" and "wss". The lowercase value is set in
+//URL.Scheme and the X-Forwarded-Host in URL.Host, so an absolute URL can be rebuilt from the returned request URL.
+//The secure protocols "https" and "wss" are emulated with a non nil TLS field.
+//
+//The optional X-Forwarded-Port is appended to the host when X-Forwarded-Host has no port and it is not the default port of
+//the protocol. The optional X-Forwarded-Prefix is kept in the request context and used by ExternalURL.
+//
+//For secure protocols, the TLS version, cipher suite, server name (SNI) and negotiated protocol (ALPN) are filled from the
+//optional X-Forwarded-Tls-Version/X-SSL-Protocol, X-Forwarded-Tls-Cipher/X-SSL-Cipher, X-Forwarded-Tls-Sni/X-SSL-Server-Name
+//and X-Forwarded-Tls-Alpn/X-SSL-ALPN headers. See ParseTLSVersion and ParseCipherSuite for the accepted values.
+//The TLS field is marked as a complete handshake and, without a SNI header, the server name is the forwarded host name.
+//Use TLSProxyAsserted to tell it from a TLS connection actually terminated by this server.
+//
+//Each X-Forwarded-For entry is parsed by ParseHop. The RemoteAddr is the client (leftmost) entry, formatted by Hop.String,
+//and the whole list is available with ForwardedFor.
+//
+//Config.TrustedProxies, Config.AllowedHosts, Config.ClientCAs and Config.RequireClientCert add policy checks, that return errors or, with
+//Config.ReportOnly, are only recorded and retrievable with Violations.
+//
+//Headers repeated in more than one line are handled with the default DuplicateCombine policy. Use a Config to change it.
 func NewProxiedRequest(r *http.Request) (*http.Request, error) {
-	//Some Constants used in namespaces and error strings.
-	//Extract and test the expected X-Forwarded-* headers, returning errors if any of them are missed.
-	xfh := r.Header.Get("X-Forwarded-Host")
-	if xfh == "" {
-		return nil, ErrMustHaveXForwardedHost
+	return (*Config)(nil).NewProxiedRequest(r)
+}
+
+//NewProxiedRequest works like the package level NewProxiedRequest, but customized by c. A nil c is the same as a zero Config.
+//
+//The forwarded values are extracted by c.Preset (XForwarded by default), then validated and embedded in the new request.
+func (c *Config) NewProxiedRequest(r *http.Request) (*http.Request, error) {
+	if c == nil {
+		c = &Config{}
 	}
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff == "" {
-		return nil, ErrMustHaveXForwardedFor
+	f := &forwarded{}
+
+	//Only trusted proxies may send forwarding headers.
+	if !c.TrustedPeer(r) {
+		if err := c.violation(f, ErrProxyMustBeTrusted); err != nil {
+			return nil, err
+		}
 	}
-	xfp := r.Header.Get("X-Forwarded-Proto")
-	if xfp == "" {
-		return nil, ErrMustHaveXForwardedProto
+
+	//Extract the forwarded values from the headers.
+	preset := c.preset()
+	fw, err := preset.Extract(c, r)
+	if err != nil {
+		return nil, err
 	}
 
-	//Create a copy of the request...
-	rCopy := new(http.Request)
-	*rCopy = *r
+	//Test the protocol, the host with its optional port, and the prefix.
+	scheme, secure := requestScheme(r), r.TLS != nil
+	if fw.Proto != "" {
+		if scheme, secure, err = parseProto(fw.Proto); err != nil {
+			return nil, err
+		}
+		f.asserted |= FieldProto
+	}
+	host := r.Host
+	if fw.Host != "" || fw.Port != "" {
+		if fw.Host != "" {
+			host = fw.Host
+			f.asserted |= FieldHost
+		}
+		if host, err = joinForwardedPort(host, fw.Port, scheme); err != nil {
+			return nil, err
+		}
+	}
+	if !c.hostAllowed(host) {
+		if err := c.violation(f, fmt.Errorf("%w: %q", ErrHostMustBeAllowed, host)); err != nil {
+			return nil, err
+		}
+	}
+	if f.prefix, err = parsePrefix(fw.Prefix); err != nil {
+		return nil, err
+	}
+
+	//Select the client.
+	remoteAddr := r.RemoteAddr
+	client := fw.Client
+	if client.Kind == HopInvalid && len(fw.For) > 0 {
+		client = c.clientHop(fw.For)
+	}
+	if client.Kind != HopInvalid {
+		remoteAddr = client.String()
+		f.asserted |= FieldClientIP
+	}
+	f.hops, f.attributes, f.preset = fw.For, fw.Attributes, preset.Name()
+
+	//Create a deep copy of the request, so the original one (and its headers) remains untouched,
+	//keeping the forwarded values that have no http.Request field in the context...
+	rCopy := r.Clone(context.WithValue(r.Context(), ctxForwarded, f))
 
 	//..and remove the headers so there is no confusion if the request came from a
 	//handler that already embed the headers.
-	rCopy.Header.Del("X-Forwarded-Host")
-	rCopy.Header.Del("X-Forwarded-For")
-	rCopy.Header.Del("X-Forwarded-Proto")
-
-	//Embed the headers...
-	rCopy.Host = xfh
-	rCopy.RemoteAddr = xff
-	//If it is not https there is nothing else to do. Skip what remmains.
-	if xfp != "https" {
+	c.StripHeaders(rCopy.Header)
+	for h, values := range fw.Header {
+		for _, v := range values {
+			rCopy.Header.Add(h, v)
+		}
+	}
+
+	//Embed the values...
+	rCopy.Host = host
+	rCopy.RemoteAddr = remoteAddr
+	//...and make the URL absolute, like it was requested to the proxy.
+	rCopy.URL.Scheme = scheme
+	rCopy.URL.Host = host
+	//If it is not https (or wss) there is nothing else to do, but the TLS a direct request may have. Skip what remmains.
+	if !secure || f.asserted&FieldProto == 0 {
+		if !secure {
+			rCopy.TLS = nil
+		}
+		if c.RequireClientCert && (rCopy.TLS == nil || len(rCopy.TLS.PeerCertificates) == 0) {
+			if err := c.violation(f, ErrMustHaveXForwardedClientCert); err != nil {
+				return nil, err
+			}
+		}
 		return rCopy, nil
 	}
 
-	//In case there is https processing create a dummy TLS field.
-	rCopy.TLS = &tls.ConnectionState{}
+	//In case there is https (or wss) processing create a TLS field, like a complete handshake with the host the client asked for,
+	//with the connection facts the proxy informed, and mark it as proxy asserted.
+	rCopy.TLS = &tls.ConnectionState{
+		HandshakeComplete:  true,
+		Version:            fw.TLS.Version,
+		CipherSuite:        fw.TLS.CipherSuite,
+		ServerName:         fw.TLS.ServerName,
+		NegotiatedProtocol: fw.TLS.NegotiatedProtocol,
+	}
+	if rCopy.TLS.ServerName == "" {
+		rCopy.TLS.ServerName = serverName(host)
+	}
+	f.tlsAsserted = true
 
-	//Extract (and remove from request) possible client certificates, and if there is none, skip certificate processing.
-	xfcc := r.Header.Get("X-Forwarded-Client-Cert")
-	rCopy.Header.Del("X-Forwarded-Client-Cert")
-	if xfcc == "" {
+	//If there are no client certificates nor identity, skip certificate processing.
+	identity := fw.Identity
+	if identity == nil && len(fw.Certificates) > 0 {
+		identity = identityFromCertificate(fw.Certificates[0])
+	}
+	if identity == nil {
+		if c.RequireClientCert {
+			if err := c.violation(f, ErrMustHaveXForwardedClientCert); err != nil {
+				return nil, err
+			}
+		}
 		return rCopy, nil
 	}
+	f.identity = identity
+	f.asserted |= FieldClientCert
 
-	//In case there are client certificates, decode the certificates in PEM blocks and return them in the request.
-	var block *pem.Block
-	pemRemainder := []byte(xfcc)
-	certs := make([]*x509.Certificate, 0)
-	for {
-		block, pemRemainder = pem.Decode(pemRemainder)
-		if block == nil {
-			break
+	//An identity asserted by the proxy without certificates cannot be verified against the CAs.
+	if len(fw.Certificates) == 0 {
+		if c.ClientCAs != nil {
+			identity.Verified = false
+			if err := c.violation(f, fmt.Errorf("%w: the proxy forwarded no certificate", ErrXForwardedClientCertMustBeVerified)); err != nil {
+				return nil, err
+			}
 		}
-		cert, err := x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			return nil, ErrXForwardedClientCertMustBeValid
+		return rCopy, nil
+	}
+
+	//In case there are client certificates return them in the request, verifying them when there are CAs to verify against.
+	rCopy.TLS.PeerCertificates = fw.Certificates
+	if err := c.verifyClientCert(rCopy.TLS); err != nil {
+		//Recorded as a violation (in report only mode), the identity is not verified, whatever the proxy asserted.
+		identity.Verified = false
+		if err := c.violation(f, err); err != nil {
+			return nil, err
 		}
-		certs = append(certs, cert)
 	}
-	rCopy.TLS.PeerCertificates = certs
+	if len(rCopy.TLS.VerifiedChains) > 0 {
+		identity.Verified = true
+	}
 	return rCopy, nil
 }
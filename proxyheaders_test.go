@@ -175,14 +175,14 @@ PgNj8cl6ndHEvt4IlMpLPQ==
 -----END CERTIFICATE-----
 `
 
-func TestInjectIntoNewRequest_Success(t *testing.T) {
+func TestNewProxiedRequest_Success(t *testing.T) {
 	{
 		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
 		req.Header.Add("X-Forwarded-For", "1.2.3.4")
 		req.Header.Add("X-Forwarded-Host", "www.example.com")
 		req.Header.Add("X-Forwarded-Proto", "http")
 
-		pr, err := proxyheaders.InjectIntoNewRequest(req)
+		pr, err := proxyheaders.NewProxiedRequest(req)
 		if want, got := error(nil), err; want != got {
 			t.Fatalf("want=%d, got=%d", want, got)
 		}
@@ -206,7 +206,7 @@ func TestInjectIntoNewRequest_Success(t *testing.T) {
 		req.Header.Add("X-Forwarded-Proto", "https")
 
 		rr := httptest.NewRecorder()
-		pr, err := proxyheaders.InjectIntoNewRequest(req)
+		pr, err := proxyheaders.NewProxiedRequest(req)
 		if want, got := error(nil), err; want != got {
 			t.Fatalf("want=%d, got=%d", want, got)
 		}
@@ -231,7 +231,7 @@ func TestInjectIntoNewRequest_Success(t *testing.T) {
 		req.Header.Add("X-Forwarded-Proto", "https")
 		req.Header.Add("X-Forwarded-Client-Cert", validCert)
 
-		pr, err := proxyheaders.InjectIntoNewRequest(req)
+		pr, err := proxyheaders.NewProxiedRequest(req)
 
 		if want, got := error(nil), err; want != got {
 			t.Fatalf("want=%d, got=%d", want, got)
@@ -266,12 +266,12 @@ func TestInjectIntoNewRequest_Success(t *testing.T) {
 	}
 }
 
-func TestInjectIntoNewRequest_failMustHaveXForwardedHost(t *testing.T) {
+func TestNewProxiedRequest_failMustHaveXForwardedHost(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
 	req.Header.Add("X-Forwarded-For", "1.2.3.4")
 	req.Header.Add("X-Forwarded-Proto", "https")
 	req.Header.Add("X-Forwarded-Client-Cert", validCert)
-	pr, err := proxyheaders.InjectIntoNewRequest(req)
+	pr, err := proxyheaders.NewProxiedRequest(req)
 	if want, got := (*http.Request)(nil), pr; want != got {
 		t.Fatalf("want=nil, got!=nil")
 	}
@@ -281,12 +281,12 @@ func TestInjectIntoNewRequest_failMustHaveXForwardedHost(t *testing.T) {
 	}
 }
 
-func TestInjectIntoNewRequest_failMustHaveXForwardedFor(t *testing.T) {
+func TestNewProxiedRequest_failMustHaveXForwardedFor(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
 	req.Header.Add("X-Forwarded-Host", "www.example.com")
 	req.Header.Add("X-Forwarded-Proto", "https")
 	req.Header.Add("X-Forwarded-Client-Cert", validCert)
-	pr, err := proxyheaders.InjectIntoNewRequest(req)
+	pr, err := proxyheaders.NewProxiedRequest(req)
 	if want, got := (*http.Request)(nil), pr; want != got {
 		t.Fatalf("want=nil, got!=nil")
 	}
@@ -295,12 +295,12 @@ func TestInjectIntoNewRequest_failMustHaveXForwardedFor(t *testing.T) {
 	}
 }
 
-func TestInjectIntoNewRequest_failMustHaveXForwardedProto(t *testing.T) {
+func TestNewProxiedRequest_failMustHaveXForwardedProto(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
 	req.Header.Add("X-Forwarded-For", "1.2.3.4")
 	req.Header.Add("X-Forwarded-Host", "www.example.com")
 	req.Header.Add("X-Forwarded-Client-Cert", validCert)
-	pr, err := proxyheaders.InjectIntoNewRequest(req)
+	pr, err := proxyheaders.NewProxiedRequest(req)
 	if want, got := (*http.Request)(nil), pr; want != got {
 		t.Fatalf("want=nil, got!=nil")
 	}
@@ -309,14 +309,14 @@ func TestInjectIntoNewRequest_failMustHaveXForwardedProto(t *testing.T) {
 	}
 }
 
-func TestInjectIntoNewRequest_failInvalidXForwardedClientCert(t *testing.T) {
+func TestNewProxiedRequest_failInvalidXForwardedClientCert(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
 	req.Header.Add("X-Forwarded-For", "1.2.3.4")
 	req.Header.Add("X-Forwarded-Host", "www.example.com")
 	req.Header.Add("X-Forwarded-Proto", "https")
 	req.Header.Add("X-Forwarded-Client-Cert", invalidCert)
 
-	pr, err := proxyheaders.InjectIntoNewRequest(req)
+	pr, err := proxyheaders.NewProxiedRequest(req)
 	if want, got := (*http.Request)(nil), pr; want != got {
 		t.Fatalf("want=nil, got!=nil")
 	}
@@ -0,0 +1,205 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	"gitlab.com/gopherburrow/proxyheaders/internal/lineno"
+)
+
+//ErrRangesMustNotBeEmpty is returned when a range file has no prefixes, or none of them match the filters.
+var ErrRangesMustNotBeEmpty = errors.New("proxyheaders: ranges must have prefixes matching the filters")
+
+//awsIPRanges is the format of https://ip-ranges.amazonaws.com/ip-ranges.json.
+type awsIPRanges struct {
+	Prefixes []struct {
+		IPPrefix string `json:"ip_prefix"`
+		Region   string `json:"region"`
+		Service  string `json:"service"`
+	} `json:"prefixes"`
+	IPv6Prefixes []struct {
+		IPv6Prefix string `json:"ipv6_prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+	} `json:"ipv6_prefixes"`
+}
+
+//googleIPRanges is the format of https://www.gstatic.com/ipranges/cloud.json and https://www.gstatic.com/ipranges/goog.json.
+type googleIPRanges struct {
+	Prefixes []struct {
+		IPv4Prefix string `json:"ipv4Prefix"`
+		IPv6Prefix string `json:"ipv6Prefix"`
+		Scope      string `json:"scope"`
+	} `json:"prefixes"`
+}
+
+//ReadAWSIPRanges reads the AWS ip-ranges.json (https://ip-ranges.amazonaws.com/ip-ranges.json), keeping the prefixes of the
+//services (like "CLOUDFRONT_ORIGIN_FACING" or "EC2") and regions (like "us-east-1" or "GLOBAL"), case-insensitive. Empty
+//services or regions match all of them.
+//
+//It returns an error wrapping ErrRangesMustNotBeEmpty if no prefix matches, what usually means a misspelled filter.
+func ReadAWSIPRanges(r io.Reader, services, regions []string) (*PrefixSet, error) {
+	var ranges awsIPRanges
+	if err := decodeRanges(r, &ranges); err != nil {
+		return nil, err
+	}
+	set := &PrefixSet{}
+	for i, p := range ranges.Prefixes {
+		if !matchFilter(p.Service, services) || !matchFilter(p.Region, regions) {
+			continue
+		}
+		if err := addRange(set, p.IPPrefix, true); err != nil {
+			return nil, fmt.Errorf("prefixes[%d]: %w", i, err)
+		}
+	}
+	for i, p := range ranges.IPv6Prefixes {
+		if !matchFilter(p.Service, services) || !matchFilter(p.Region, regions) {
+			continue
+		}
+		if err := addRange(set, p.IPv6Prefix, false); err != nil {
+			return nil, fmt.Errorf("ipv6_prefixes[%d]: %w", i, err)
+		}
+	}
+	if set.Len() == 0 {
+		return nil, fmt.Errorf("%w: services %q, regions %q", ErrRangesMustNotBeEmpty, services, regions)
+	}
+	return set, nil
+}
+
+//ReadGoogleIPRanges reads the Google cloud.json (https://www.gstatic.com/ipranges/cloud.json) or goog.json
+//(https://www.gstatic.com/ipranges/goog.json), keeping the prefixes of the scopes (like "us-central1"), case-insensitive.
+//No scopes match all of them; goog.json has no scopes.
+//
+//It returns an error wrapping ErrRangesMustNotBeEmpty if no prefix matches, what usually means a misspelled filter.
+func ReadGoogleIPRanges(r io.Reader, scopes ...string) (*PrefixSet, error) {
+	var ranges googleIPRanges
+	if err := decodeRanges(r, &ranges); err != nil {
+		return nil, err
+	}
+	set := &PrefixSet{}
+	for i, p := range ranges.Prefixes {
+		if !matchFilter(p.Scope, scopes) {
+			continue
+		}
+		var err error
+		switch {
+		case p.IPv4Prefix != "" && p.IPv6Prefix == "":
+			err = addRange(set, p.IPv4Prefix, true)
+		case p.IPv6Prefix != "" && p.IPv4Prefix == "":
+			err = addRange(set, p.IPv6Prefix, false)
+		default:
+			err = errors.New("proxyheaders: must have either ipv4Prefix or ipv6Prefix")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("prefixes[%d]: %w", i, err)
+		}
+	}
+	if set.Len() == 0 {
+		return nil, fmt.Errorf("%w: scopes %q", ErrRangesMustNotBeEmpty, scopes)
+	}
+	return set, nil
+}
+
+//LoadAWSIPRanges reads an AWS ip-ranges.json file. See ReadAWSIPRanges.
+func LoadAWSIPRanges(path string, services, regions []string) (*PrefixSet, error) {
+	return loadRanges(path, func(r io.Reader) (*PrefixSet, error) {
+		return ReadAWSIPRanges(r, services, regions)
+	})
+}
+
+//LoadGoogleIPRanges reads a Google cloud.json or goog.json file. See ReadGoogleIPRanges.
+func LoadGoogleIPRanges(path string, scopes ...string) (*PrefixSet, error) {
+	return loadRanges(path, func(r io.Reader) (*PrefixSet, error) {
+		return ReadGoogleIPRanges(r, scopes...)
+	})
+}
+
+//MergePrefixSets returns a new set with the prefixes of all the sets, like the ranges of the providers in front of the
+//application, to be used as Config.TrustedProxies. Nil sets are ignored.
+func MergePrefixSets(sets ...*PrefixSet) *PrefixSet {
+	merged := &PrefixSet{}
+	for _, s := range sets {
+		merged.Add(s.Prefixes()...)
+	}
+	return merged
+}
+
+//loadRanges opens a file and reads it with read, adding the path to the errors.
+func loadRanges(path string, read func(io.Reader) (*PrefixSet, error)) (*PrefixSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	set, err := read(file)
+	if err != nil {
+		return nil, fmt.Errorf("proxyheaders: %s: %w", path, err)
+	}
+	return set, nil
+}
+
+//decodeRanges decodes a JSON range file, reporting the line of syntax errors.
+func decodeRanges(r io.Reader, v interface{}) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return fmt.Errorf("line %d: %w", lineno.Of(data, syntaxErr.Offset), err)
+		case errors.As(err, &typeErr):
+			return fmt.Errorf("line %d: %w", lineno.Of(data, typeErr.Offset), err)
+		}
+		return err
+	}
+	return nil
+}
+
+//addRange adds a CIDR of the expected family to set.
+func addRange(set *PrefixSet, cidr string, ipv4 bool) error {
+	p, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+	if err != nil {
+		return fmt.Errorf("proxyheaders: invalid CIDR %q: %w", cidr, err)
+	}
+	if p.Addr().Is4() != ipv4 {
+		return fmt.Errorf("proxyheaders: CIDR %q of the wrong IP version", cidr)
+	}
+	set.Add(p)
+	return nil
+}
+
+//matchFilter reports if v is one of filter, case-insensitive, or filter is empty.
+func matchFilter(v string, filter []string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		if strings.EqualFold(v, strings.TrimSpace(f)) {
+			return true
+		}
+	}
+	return false
+}
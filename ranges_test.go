@@ -0,0 +1,167 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+const testAWSIPRanges = `{
+  "syncToken": "1700000000",
+  "createDate": "2023-11-14-22-13-20",
+  "prefixes": [
+    {"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "AMAZON", "network_border_group": "ap-northeast-2"},
+    {"ip_prefix": "13.32.0.0/15", "region": "GLOBAL", "service": "CLOUDFRONT", "network_border_group": "GLOBAL"},
+    {"ip_prefix": "52.94.76.0/22", "region": "us-east-1", "service": "EC2", "network_border_group": "us-east-1"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:9000::/28", "region": "GLOBAL", "service": "CLOUDFRONT", "network_border_group": "GLOBAL"},
+    {"ipv6_prefix": "2600:1f18::/33", "region": "us-east-1", "service": "EC2", "network_border_group": "us-east-1"}
+  ]
+}`
+
+const testGoogleIPRanges = `{
+  "syncToken": "1700000000",
+  "creationTime": "2023-11-14T22:13:20",
+  "prefixes": [
+    {"ipv4Prefix": "34.1.208.0/20", "service": "Google Cloud", "scope": "africa-south1"},
+    {"ipv4Prefix": "34.16.0.0/17", "service": "Google Cloud", "scope": "us-central1"},
+    {"ipv6Prefix": "2600:1900:4000::/44", "service": "Google Cloud", "scope": "us-central1"}
+  ]
+}`
+
+func TestReadAWSIPRanges(t *testing.T) {
+	set, err := proxyheaders.ReadAWSIPRanges(strings.NewReader(testAWSIPRanges), []string{"cloudfront"}, nil)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := 2, set.Len(); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := true, set.Contains(netip.MustParseAddr("2600:9000::1")); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	set, err = proxyheaders.ReadAWSIPRanges(strings.NewReader(testAWSIPRanges), nil, []string{"us-east-1", "GLOBAL"})
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := 4, set.Len(); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	_, err = proxyheaders.ReadAWSIPRanges(strings.NewReader(testAWSIPRanges), []string{"CLOUDFRONTT"}, nil)
+	if want, got := true, errors.Is(err, proxyheaders.ErrRangesMustNotBeEmpty); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	_, err = proxyheaders.ReadAWSIPRanges(strings.NewReader(`{"prefixes": [{"ip_prefix": "13.32.0.0/33"}]}`), nil, nil)
+	if want, got := true, err != nil && strings.HasPrefix(err.Error(), "prefixes[0]: "); want != got {
+		t.Fatalf("want=%t, got=%v", want, err)
+	}
+	_, err = proxyheaders.ReadAWSIPRanges(strings.NewReader(`{"ipv6_prefixes": [{"ipv6_prefix": "13.32.0.0/15"}]}`), nil, nil)
+	if want, got := true, err != nil && strings.HasPrefix(err.Error(), "ipv6_prefixes[0]: "); want != got {
+		t.Fatalf("want=%t, got=%v", want, err)
+	}
+	_, err = proxyheaders.ReadAWSIPRanges(strings.NewReader("{\n  \"prefixes\": [\n    {\"ip_prefix\": }\n  ]\n}"), nil, nil)
+	if want, got := true, err != nil && strings.HasPrefix(err.Error(), "line 3: "); want != got {
+		t.Fatalf("want=%t, got=%v", want, err)
+	}
+}
+
+func TestReadGoogleIPRanges(t *testing.T) {
+	set, err := proxyheaders.ReadGoogleIPRanges(strings.NewReader(testGoogleIPRanges), "us-central1")
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := 2, set.Len(); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := false, set.Contains(netip.MustParseAddr("34.1.208.1")); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	//goog.json has no scopes.
+	set, err = proxyheaders.ReadGoogleIPRanges(strings.NewReader(`{"prefixes": [{"ipv4Prefix": "8.8.4.0/24"}, {"ipv6Prefix": "2001:4860::/32"}]}`))
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := 2, set.Len(); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	_, err = proxyheaders.ReadGoogleIPRanges(strings.NewReader(`{"prefixes": [{"ipv4Prefix": "8.8.4.0/24", "ipv6Prefix": "2001:4860::/32"}]}`))
+	if want, got := true, err != nil && strings.HasPrefix(err.Error(), "prefixes[0]: "); want != got {
+		t.Fatalf("want=%t, got=%v", want, err)
+	}
+	_, err = proxyheaders.ReadGoogleIPRanges(strings.NewReader(`{"prefixes": []}`))
+	if want, got := true, errors.Is(err, proxyheaders.ErrRangesMustNotBeEmpty); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+}
+
+func TestLoadIPRanges(t *testing.T) {
+	dir := t.TempDir()
+	awsPath := filepath.Join(dir, "ip-ranges.json")
+	googlePath := filepath.Join(dir, "cloud.json")
+	cloudflarePath := filepath.Join(dir, "ips-v4")
+	for path, content := range map[string]string{
+		awsPath:        testAWSIPRanges,
+		googlePath:     testGoogleIPRanges,
+		cloudflarePath: "173.245.48.0/20\n103.21.244.0/22\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aws, err := proxyheaders.LoadAWSIPRanges(awsPath, []string{"CLOUDFRONT"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	google, err := proxyheaders.LoadGoogleIPRanges(googlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cloudflare, err := proxyheaders.LoadPrefixFiles(cloudflarePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &proxyheaders.Config{TrustedProxies: proxyheaders.MergePrefixSets(aws, google, cloudflare, nil)}
+	if want, got := 7, c.TrustedProxies.Len(); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	for peer, want := range map[string]bool{"13.32.1.1:443": true, "34.16.0.1:443": true, "173.245.48.1:443": true, "52.94.76.1:443": false} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.RemoteAddr = peer
+		if got := c.TrustedPeer(req); want != got {
+			t.Fatalf("peer=%s: want=%t, got=%t", peer, want, got)
+		}
+	}
+
+	_, err = proxyheaders.LoadAWSIPRanges(googlePath, nil, nil)
+	if want, got := true, err != nil && strings.Contains(err.Error(), googlePath); want != got {
+		t.Fatalf("want=%t, got=%v", want, err)
+	}
+}
@@ -0,0 +1,171 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+//Headers carrying the facts of the TLS connection terminated in the proxy. When more than one header is present for the same fact,
+//the first one in the list wins.
+var (
+	tlsVersionHeaders     = []string{"X-Forwarded-Tls-Version", "X-SSL-Protocol"}
+	tlsCipherSuiteHeaders = []string{"X-Forwarded-Tls-Cipher", "X-SSL-Cipher"}
+	tlsServerNameHeaders  = []string{"X-Forwarded-Tls-Sni", "X-SSL-Server-Name"}
+	tlsALPNHeaders        = []string{"X-Forwarded-Tls-Alpn", "X-SSL-ALPN"}
+)
+
+//tlsVersions maps the protocol names used by OpenSSL, nginx, HAProxy and others, normalized by normalizeTLSVersion,
+//to Go constants.
+var tlsVersions = map[string]uint16{
+	"ssl3":  tls.VersionSSL30, //Deprecated in Go, but still reported by old proxies.
+	"tls1":  tls.VersionTLS10,
+	"tls10": tls.VersionTLS10,
+	"tls11": tls.VersionTLS11,
+	"tls12": tls.VersionTLS12,
+	"tls13": tls.VersionTLS13,
+}
+
+//openSSLCipherSuites maps OpenSSL cipher names to Go constants. TLS 1.3 suites have the same name in OpenSSL and IANA,
+//so they are resolved by the IANA names.
+var openSSLCipherSuites = map[string]uint16{
+	"ECDHE-ECDSA-AES128-GCM-SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"ECDHE-RSA-AES128-GCM-SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"ECDHE-ECDSA-AES256-GCM-SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE-RSA-AES256-GCM-SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE-ECDSA-CHACHA20-POLY1305": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	"ECDHE-RSA-CHACHA20-POLY1305":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	"ECDHE-ECDSA-AES128-SHA256":     tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	"ECDHE-RSA-AES128-SHA256":       tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	"ECDHE-ECDSA-AES128-SHA":        tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"ECDHE-RSA-AES128-SHA":          tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"ECDHE-ECDSA-AES256-SHA":        tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"ECDHE-RSA-AES256-SHA":          tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"ECDHE-ECDSA-RC4-SHA":           tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+	"ECDHE-RSA-RC4-SHA":             tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+	"ECDHE-RSA-DES-CBC3-SHA":        tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"AES128-GCM-SHA256":             tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"AES256-GCM-SHA384":             tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"AES128-SHA256":                 tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	"AES128-SHA":                    tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"AES256-SHA":                    tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"DES-CBC3-SHA":                  tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"RC4-SHA":                       tls.TLS_RSA_WITH_RC4_128_SHA,
+}
+
+//ParseTLSVersion converts a TLS protocol version, as reported by proxies, to the Go constant (tls.VersionTLS12, etc).
+//
+//Names like "TLSv1.2" (OpenSSL, nginx, HAProxy), "TLS 1.2", "tls1.2", "TLS12" and the bare "1.2" are accepted, case-insensitively.
+func ParseTLSVersion(s string) (uint16, error) {
+	if v, ok := tlsVersions[normalizeTLSVersion(s)]; ok {
+		return v, nil
+	}
+	return 0, ErrTLSVersionMustBeValid
+}
+
+//normalizeTLSVersion lowercases and removes the separators and "v" from a version string, so "TLSv1.2" becomes "tls12".
+func normalizeTLSVersion(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer("v", "", ".", "", " ", "", "_", "", "-", "").Replace(s)
+	if s != "" && s[0] >= '0' && s[0] <= '9' {
+		s = "tls" + s
+	}
+	return s
+}
+
+//ParseCipherSuite converts a cipher suite name, as reported by proxies, to the Go constant (tls.TLS_AES_128_GCM_SHA256, etc).
+//
+//Both OpenSSL names ("ECDHE-RSA-AES128-GCM-SHA256") and IANA names ("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256") are accepted.
+func ParseCipherSuite(s string) (uint16, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if id, ok := openSSLCipherSuites[s]; ok {
+		return id, nil
+	}
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, cs := range suites {
+			if cs.Name == s {
+				return cs.ID, nil
+			}
+		}
+	}
+	return 0, ErrTLSCipherSuiteMustBeValid
+}
+
+//firstHeader returns the value of the first present header of names.
+func (c *Config) firstHeader(h http.Header, names []string) (string, error) {
+	for _, n := range names {
+		v, err := c.Header(h, n)
+		if err != nil {
+			return "", err
+		}
+		if v = strings.TrimSpace(v); v != "" {
+			return v, nil
+		}
+	}
+	return "", nil
+}
+
+//extractTLSHeaders reads the TLS version, cipher suite, SNI and ALPN informed by the proxy in h.
+func (c *Config) extractTLSHeaders(h http.Header) (ForwardedTLS, error) {
+	var t ForwardedTLS
+	v, err := c.firstHeader(h, tlsVersionHeaders)
+	if err != nil {
+		return t, err
+	}
+	if v != "" {
+		if t.Version, err = ParseTLSVersion(v); err != nil {
+			return t, err
+		}
+	}
+	if v, err = c.firstHeader(h, tlsCipherSuiteHeaders); err != nil {
+		return t, err
+	}
+	if v != "" {
+		if t.CipherSuite, err = ParseCipherSuite(v); err != nil {
+			return t, err
+		}
+	}
+	if v, err = c.firstHeader(h, tlsServerNameHeaders); err != nil {
+		return t, err
+	}
+	t.ServerName = strings.ToLower(v)
+	if t.NegotiatedProtocol, err = c.firstHeader(h, tlsALPNHeaders); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+//serverName returns the name a client would send in the SNI extension to reach host: the host name without port.
+//IP literals are not sent in SNI, so they result in an empty name.
+func serverName(host string) string {
+	name := hostName(host)
+	if _, err := netip.ParseAddr(name); err == nil {
+		return ""
+	}
+	return name
+}
+
+//hostName returns host in lowercase, without port, IPv6 brackets and trailing dot.
+func hostName(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+}
@@ -0,0 +1,194 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		s string
+		v uint16
+	}{
+		{"TLSv1", tls.VersionTLS10},
+		{"TLSv1.1", tls.VersionTLS11},
+		{"TLSv1.2", tls.VersionTLS12},
+		{"TLSv1.3", tls.VersionTLS13},
+		{"TLS 1.2", tls.VersionTLS12},
+		{"tls1.3", tls.VersionTLS13},
+		{"TLS13", tls.VersionTLS13},
+		{"1.2", tls.VersionTLS12},
+	}
+	for _, tt := range tests {
+		v, err := proxyheaders.ParseTLSVersion(tt.s)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("%q: want=%v, got=%v", tt.s, want, got)
+		}
+		if want, got := tt.v, v; want != got {
+			t.Fatalf("%q: want=%x, got=%x", tt.s, want, got)
+		}
+	}
+
+	for _, s := range []string{"", "TLSv1.4", "QUIC", "banana"} {
+		_, err := proxyheaders.ParseTLSVersion(s)
+		if want, got := proxyheaders.ErrTLSVersionMustBeValid, err; want != got {
+			t.Fatalf("%q: want=%v, got=%v", s, want, got)
+		}
+	}
+}
+
+func TestParseCipherSuite(t *testing.T) {
+	tests := []struct {
+		s  string
+		id uint16
+	}{
+		{"ECDHE-RSA-AES128-GCM-SHA256", tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		{"ECDHE-ECDSA-CHACHA20-POLY1305", tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256},
+		{"AES256-SHA", tls.TLS_RSA_WITH_AES_256_CBC_SHA},
+		{"TLS_AES_128_GCM_SHA256", tls.TLS_AES_128_GCM_SHA256},
+		{"TLS_CHACHA20_POLY1305_SHA256", tls.TLS_CHACHA20_POLY1305_SHA256},
+		{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+		{"tls_rsa_with_rc4_128_sha", tls.TLS_RSA_WITH_RC4_128_SHA},
+	}
+	for _, tt := range tests {
+		id, err := proxyheaders.ParseCipherSuite(tt.s)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("%q: want=%v, got=%v", tt.s, want, got)
+		}
+		if want, got := tt.id, id; want != got {
+			t.Fatalf("%q: want=%x, got=%x", tt.s, want, got)
+		}
+	}
+
+	if _, err := proxyheaders.ParseCipherSuite("NULL-MD5"); err != proxyheaders.ErrTLSCipherSuiteMustBeValid {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrTLSCipherSuiteMustBeValid, err)
+	}
+}
+
+func TestNewProxiedRequest_tlsHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-SSL-Protocol", "TLSv1.2")
+	req.Header.Add("X-SSL-Cipher", "ECDHE-RSA-AES256-GCM-SHA384")
+	req.Header.Add("X-Forwarded-Tls-Sni", "API.example.com")
+	req.Header.Add("X-Forwarded-Tls-Alpn", "h2")
+
+	pr, err := proxyheaders.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := uint16(tls.VersionTLS12), pr.TLS.Version; want != got {
+		t.Fatalf("want=%x, got=%x", want, got)
+	}
+	if want, got := tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, pr.TLS.CipherSuite; want != got {
+		t.Fatalf("want=%x, got=%x", want, got)
+	}
+	if want, got := "api.example.com", pr.TLS.ServerName; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "h2", pr.TLS.NegotiatedProtocol; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	if want, got := "", pr.Header.Get("X-SSL-Cipher"); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+}
+
+func TestNewProxiedRequest_failInvalidTLSHeaders(t *testing.T) {
+	tests := []struct {
+		header, value string
+		err           error
+	}{
+		{"X-Forwarded-Tls-Version", "TLSv9", proxyheaders.ErrTLSVersionMustBeValid},
+		{"X-SSL-Cipher", "NOT-A-CIPHER", proxyheaders.ErrTLSCipherSuiteMustBeValid},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", "www.example.com")
+		req.Header.Add("X-Forwarded-Proto", "https")
+		req.Header.Add(tt.header, tt.value)
+
+		pr, err := proxyheaders.NewProxiedRequest(req)
+		if want, got := (*http.Request)(nil), pr; want != got {
+			t.Fatalf("want=nil, got!=nil")
+		}
+		if want, got := tt.err, err; want != got {
+			t.Fatalf("want=%v, got=%v", want, got)
+		}
+	}
+}
+
+func TestNewProxiedRequest_tlsSynthesized(t *testing.T) {
+	tests := []struct {
+		host, sni, serverName string
+	}{
+		{"WWW.Example.com:8443", "", "www.example.com"},
+		{"www.example.com", "api.example.com", "api.example.com"},
+		{"[2001:db8::1]:8443", "", ""},
+		{"10.0.0.1", "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", tt.host)
+		req.Header.Add("X-Forwarded-Proto", "https")
+		if tt.sni != "" {
+			req.Header.Add("X-SSL-Server-Name", tt.sni)
+		}
+
+		pr, err := proxyheaders.NewProxiedRequest(req)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("want=%v, got=%v", want, got)
+		}
+		if want, got := true, pr.TLS.HandshakeComplete; want != got {
+			t.Fatalf("want=%t, got=%t", want, got)
+		}
+		if want, got := tt.serverName, pr.TLS.ServerName; want != got {
+			t.Fatalf("want=%s, got=%s", want, got)
+		}
+		if want, got := true, proxyheaders.TLSProxyAsserted(pr); want != got {
+			t.Fatalf("want=%t, got=%t", want, got)
+		}
+	}
+}
+
+func TestTLSProxyAsserted_notAsserted(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://www.example.com/", nil)
+	if want, got := false, proxyheaders.TLSProxyAsserted(req); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "http")
+	pr, err := proxyheaders.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := false, proxyheaders.TLSProxyAsserted(pr); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+}
@@ -0,0 +1,139 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net/netip"
+)
+
+//trieNode is a node of a path-compressed binary trie of prefixes. The keys are 128 bits, left aligned in hi and lo: IPv4
+//addresses use the 32 most significant bits of hi, in a trie of their own.
+//
+//Each node holds the bits its subtree has in common, so chains of single children are collapsed in a node, and lookups
+//visit at most one node per branching bit.
+type trieNode struct {
+	//hi and lo are the key bits, masked to length.
+	hi, lo uint64
+	//length is the number of bits of the node prefix.
+	length int
+	//terminal is true when the node prefix is in the set.
+	terminal bool
+	//child are the subtrees whose next bit, after length, is 0 and 1.
+	child [2]*trieNode
+}
+
+//trieKey returns the key bits of addr, that must not be an IPv4-mapped IPv6 address.
+func trieKey(addr netip.Addr) (hi, lo uint64) {
+	if addr.Is4() {
+		a := addr.As4()
+		return uint64(binary.BigEndian.Uint32(a[:])) << 32, 0
+	}
+	a := addr.As16()
+	return binary.BigEndian.Uint64(a[:8]), binary.BigEndian.Uint64(a[8:])
+}
+
+//trieMask keeps the first length bits of a key.
+func trieMask(hi, lo uint64, length int) (uint64, uint64) {
+	switch {
+	case length == 0:
+		return 0, 0
+	case length < 64:
+		return hi &^ (1<<(64-length) - 1), 0
+	case length == 64:
+		return hi, 0
+	case length < 128:
+		return hi, lo &^ (1<<(128-length) - 1)
+	}
+	return hi, lo
+}
+
+//trieBit returns the bit i of a key, counting from the most significant.
+func trieBit(hi, lo uint64, i int) int {
+	if i < 64 {
+		return int(hi>>(63-i)) & 1
+	}
+	return int(lo>>(127-i)) & 1
+}
+
+//trieCommon returns the number of leading bits two keys have in common, up to limit.
+func trieCommon(ahi, alo, bhi, blo uint64, limit int) int {
+	n := bits.LeadingZeros64(ahi ^ bhi)
+	if n == 64 {
+		n += bits.LeadingZeros64(alo ^ blo)
+	}
+	if n > limit {
+		return limit
+	}
+	return n
+}
+
+//trieInsert adds the prefix with the key bits and length to the trie rooted at *t.
+func trieInsert(t **trieNode, hi, lo uint64, length int) {
+	hi, lo = trieMask(hi, lo, length)
+	for {
+		n := *t
+		if n == nil {
+			*t = &trieNode{hi: hi, lo: lo, length: length, terminal: true}
+			return
+		}
+		common := trieCommon(hi, lo, n.hi, n.lo, min(length, n.length))
+
+		//The node is not within the prefix: split it, in a node with the common bits.
+		if common < n.length {
+			parentHi, parentLo := trieMask(hi, lo, common)
+			parent := &trieNode{hi: parentHi, lo: parentLo, length: common}
+			if common == length {
+				//The new prefix covers the node, that is no longer needed.
+				parent.terminal = true
+			} else {
+				parent.child[trieBit(n.hi, n.lo, common)] = n
+				parent.child[trieBit(hi, lo, common)] = &trieNode{hi: hi, lo: lo, length: length, terminal: true}
+			}
+			*t = parent
+			return
+		}
+
+		//The node is within the prefix.
+		switch {
+		case n.terminal:
+			//It is already covered.
+			return
+		case length == n.length:
+			n.terminal, n.child = true, [2]*trieNode{}
+			return
+		}
+		t = &n.child[trieBit(hi, lo, n.length)]
+	}
+}
+
+//trieContains reports if the key with length bits (32 or 128) is within a prefix of the trie rooted at n. It does not allocate.
+func trieContains(n *trieNode, hi, lo uint64, length int) bool {
+	for n != nil {
+		if trieCommon(hi, lo, n.hi, n.lo, n.length) < n.length {
+			return false
+		}
+		if n.terminal {
+			return true
+		}
+		if n.length >= length {
+			return false
+		}
+		n = n.child[trieBit(hi, lo, n.length)]
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+//randomAddr returns a random IPv4 or IPv6 address.
+func randomAddr(rnd *rand.Rand, ipv6 bool) netip.Addr {
+	if ipv6 {
+		var a [16]byte
+		rnd.Read(a[:])
+		//Keep the addresses close, so they share prefixes.
+		a[0], a[1] = 0x20, 0x01
+		return netip.AddrFrom16(a)
+	}
+	var a [4]byte
+	rnd.Read(a[:])
+	return netip.AddrFrom4(a)
+}
+
+//randomPrefixes returns n random prefixes, IPv4 and IPv6, of varied lengths.
+func randomPrefixes(rnd *rand.Rand, n int) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, n)
+	for i := 0; i < n; i++ {
+		addr := randomAddr(rnd, i%2 == 1)
+		bits := 8 + rnd.Intn(25)
+		if addr.Is6() {
+			bits = 16 + rnd.Intn(113)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, bits))
+	}
+	return prefixes
+}
+
+//linearContains is the reference implementation of PrefixSet.Contains.
+func linearContains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPrefixSet_trie(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		prefixes := randomPrefixes(rnd, 1+rnd.Intn(200))
+		s := proxyheaders.NewPrefixSet(prefixes...)
+		masked := s.Prefixes()
+		for i := 0; i < 2000; i++ {
+			addr := randomAddr(rnd, i%2 == 1)
+			//Half of the addresses are inside a prefix.
+			if i%4 < 2 {
+				p := prefixes[rnd.Intn(len(prefixes))]
+				if p.Addr().Is6() != addr.Is6() {
+					continue
+				}
+				a, b := p.Masked().Addr().As16(), addr.As16()
+				for j := range a {
+					bit := j * 8
+					if p.Addr().Is4() {
+						bit -= 96
+					}
+					switch {
+					case bit+8 <= p.Bits():
+						b[j] = a[j]
+					case bit < p.Bits():
+						mask := byte(0xff << (8 - (p.Bits() - bit)))
+						b[j] = a[j]&mask | b[j]&^mask
+					}
+				}
+				addr = netip.AddrFrom16(b)
+				if p.Addr().Is4() {
+					addr = addr.Unmap()
+				}
+			}
+			if want, got := linearContains(masked, addr), s.Contains(addr); want != got {
+				t.Fatalf("round %d, %s: want=%t, got=%t", round, addr, want, got)
+			}
+		}
+	}
+}
+
+func TestPrefixSet_overlapping(t *testing.T) {
+	s, err := proxyheaders.ParsePrefixSet("10.1.2.0/24", "10.1.0.0/16", "10.1.2.3", "0.0.0.0/0", "2001:db8:1::/48", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{"10.1.2.3": true, "11.0.0.1": true, "2001:db8:2::1": true, "2001:db9::1": false} {
+		if got := s.Contains(netip.MustParseAddr(addr)); want != got {
+			t.Fatalf("%s: want=%t, got=%t", addr, want, got)
+		}
+	}
+	if want, got := 6, s.Len(); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+}
+
+func TestPrefixSet_allocs(t *testing.T) {
+	s := proxyheaders.NewPrefixSet(randomPrefixes(rand.New(rand.NewSource(1)), 1000)...)
+	v4, v6 := netip.MustParseAddr("203.0.113.7"), netip.MustParseAddr("2001:db8::1")
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Contains(v4)
+		s.Contains(v6)
+	})
+	if want, got := 0.0, allocs; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func BenchmarkPrefixSet_Contains(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	s := proxyheaders.NewPrefixSet(randomPrefixes(rnd, 5000)...)
+	addrs := make([]netip.Addr, 1024)
+	for i := range addrs {
+		addrs[i] = randomAddr(rnd, i%2 == 1)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Contains(addrs[i%len(addrs)])
+	}
+}
+
+func BenchmarkPrefixSet_linear(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	prefixes := proxyheaders.NewPrefixSet(randomPrefixes(rnd, 5000)...).Prefixes()
+	addrs := make([]netip.Addr, 1024)
+	for i := range addrs {
+		addrs[i] = randomAddr(rnd, i%2 == 1)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearContains(prefixes, addrs[i%len(addrs)])
+	}
+}
+
+func BenchmarkConfig_NewProxiedRequest_trustedProxies(b *testing.B) {
+	c := &proxyheaders.Config{TrustedProxies: proxyheaders.MergePrefixSets(
+		proxyheaders.CloudflareRanges(),
+		proxyheaders.NewPrefixSet(randomPrefixes(rand.New(rand.NewSource(1)), 5000)...),
+	)}
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "173.245.48.1:443"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7, 198.51.100.1, 173.245.48.2")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.NewProxiedRequest(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+//PrefixSet is a set of IP prefixes, used to match the addresses of trusted proxies.
+//
+//The prefixes are kept in compressed binary tries, one for IPv4 and one for IPv6, so matching an address does not depend
+//on the number of prefixes and does not allocate.
+//
+//A nil *PrefixSet is empty. A PrefixSet must not be modified while in use by a Config.
+type PrefixSet struct {
+	prefixes []netip.Prefix
+	//ipv4 and ipv6 are the roots of the tries.
+	ipv4, ipv6 *trieNode
+}
+
+//NewPrefixSet returns a set with prefixes.
+func NewPrefixSet(prefixes ...netip.Prefix) *PrefixSet {
+	s := &PrefixSet{}
+	s.Add(prefixes...)
+	return s
+}
+
+//ParsePrefixSet returns a set with the CIDRs in s, like "10.0.0.0/8" or "2001:db8::/32". Single addresses, like "10.0.0.1",
+//are accepted as a prefix with all bits.
+func ParsePrefixSet(s ...string) (*PrefixSet, error) {
+	set := &PrefixSet{}
+	for _, v := range s {
+		p, err := parseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		set.Add(p)
+	}
+	return set, nil
+}
+
+//ReadPrefixList reads a list of CIDRs or single addresses, one per line, like the ips-v4 and ips-v6 files published by Cloudflare.
+//Blank lines and comments, starting with "#", are ignored.
+func ReadPrefixList(r io.Reader) (*PrefixSet, error) {
+	set := &PrefixSet{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p, err := parseCIDR(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		set.Add(p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+//LoadPrefixFiles reads the prefix lists in the files (see ReadPrefixList), merging them in a single set.
+func LoadPrefixFiles(paths ...string) (*PrefixSet, error) {
+	set := &PrefixSet{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		s, err := ReadPrefixList(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("proxyheaders: %s: %w", path, err)
+		}
+		set.Add(s.prefixes...)
+	}
+	return set, nil
+}
+
+//parseCIDR parses a CIDR or a single address.
+func parseCIDR(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("proxyheaders: invalid CIDR %q: %w", s, err)
+		}
+		return p, nil
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("proxyheaders: invalid address %q: %w", s, err)
+	}
+	a = a.Unmap().WithZone("")
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+//Add adds prefixes to the set. IPv4-mapped IPv6 prefixes are normalized to IPv4 and host bits are masked.
+func (s *PrefixSet) Add(prefixes ...netip.Prefix) {
+	for _, p := range prefixes {
+		if !p.IsValid() {
+			continue
+		}
+		if a := p.Addr(); a.Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(a.Unmap(), p.Bits()-96)
+		}
+		p = p.Masked()
+		s.prefixes = append(s.prefixes, p)
+		hi, lo := trieKey(p.Addr())
+		if p.Addr().Is4() {
+			trieInsert(&s.ipv4, hi, lo, p.Bits())
+		} else {
+			trieInsert(&s.ipv6, hi, lo, p.Bits())
+		}
+	}
+}
+
+//Contains reports if addr is in any prefix of the set.
+func (s *PrefixSet) Contains(addr netip.Addr) bool {
+	if s == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	if !addr.IsValid() {
+		return false
+	}
+	hi, lo := trieKey(addr)
+	if addr.Is4() {
+		return trieContains(s.ipv4, hi, lo, 32)
+	}
+	return trieContains(s.ipv6, hi, lo, 128)
+}
+
+//Prefixes returns a copy of the prefixes in the set.
+func (s *PrefixSet) Prefixes() []netip.Prefix {
+	if s == nil {
+		return nil
+	}
+	return append([]netip.Prefix(nil), s.prefixes...)
+}
+
+//Len returns the number of prefixes in the set.
+func (s *PrefixSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.prefixes)
+}
+
+//TrustedPeer reports if the request peer (http.Request.RemoteAddr) is one of the TrustedProxies, or of the proxies of the Preset.
+//If none of them is set, every peer is trusted. A nil c is the same as a zero Config.
+func (c *Config) TrustedPeer(r *http.Request) bool {
+	if c == nil || c.trustsAll() {
+		return true
+	}
+	h, err := ParseHop(r.RemoteAddr)
+	return err == nil && h.HasAddr() && c.trusted(h.Addr)
+}
+
+//trustsAll reports if there are no trusted proxies configured, so every peer is trusted.
+func (c *Config) trustsAll() bool {
+	return c.TrustedProxies == nil && c.preset().TrustedProxies() == nil
+}
+
+//trusted reports if addr is one of the trusted proxies.
+func (c *Config) trusted(addr netip.Addr) bool {
+	return c.TrustedProxies.Contains(addr) || c.preset().TrustedProxies().Contains(addr)
+}
+
+//clientHop selects the client among the hops: the rightmost one that is not a trusted proxy,
+//or the leftmost when there are no trusted proxies or all of them are trusted.
+func (c *Config) clientHop(hops []Hop) Hop {
+	if c.trustsAll() {
+		return hops[0]
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !hops[i].HasAddr() || !c.trusted(hops[i].Addr) {
+			return hops[i]
+		}
+	}
+	return hops[0]
+}
+
+//hostAllowed reports if the forwarded host is in the allowed hosts.
+func (c *Config) hostAllowed(host string) bool {
+	if len(c.AllowedHosts) == 0 {
+		return true
+	}
+	name := hostName(host)
+	for _, allowed := range c.AllowedHosts {
+		allowed = strings.ToLower(strings.TrimSuffix(allowed, "."))
+		if allowed == name || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(name, allowed[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+//verifyClientCert verifies the peer certificates of state against the client CAs, filling the verified chains.
+func (c *Config) verifyClientCert(state *tls.ConnectionState) error {
+	if c.ClientCAs == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         c.ClientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrXForwardedClientCertMustBeVerified, err)
+	}
+	now := time.Now()
+	for _, chain := range chains {
+		for i := 0; i < len(chain)-1; i++ {
+			if err := c.checkRevocation(chain[i], chain[i+1], now); err != nil {
+				return err
+			}
+		}
+	}
+	state.VerifiedChains = chains
+	return nil
+}
+
+//checkRevocation checks cert against the client CRLs signed by its issuer. A CRL past its NextUpdate no longer tells
+//if cert was revoked since, so the certificate cannot be verified.
+func (c *Config) checkRevocation(cert, issuer *x509.Certificate, now time.Time) error {
+	for _, crl := range c.ClientCRLs {
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) || crl.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+		if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+			return fmt.Errorf("%w: the CRL of %q expired at %s", ErrXForwardedClientCertMustBeVerified, issuer.Subject.String(), crl.NextUpdate.Format(time.RFC3339))
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("%w: %q serial %X", ErrXForwardedClientCertMustNotBeRevoked, cert.Subject.String(), cert.SerialNumber)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+//newCert creates a certificate signed by parent (or self-signed if parent is nil), returning it and its key.
+func newCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+//pemEncode encodes certs as PEM.
+func pemEncode(certs ...*x509.Certificate) string {
+	var s string
+	for _, c := range certs {
+		s += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}
+	return s
+}
+
+func TestPrefixSet(t *testing.T) {
+	s, err := proxyheaders.ParsePrefixSet("10.0.0.0/8", "192.168.1.1", "2001:db8::/32", "::ffff:172.16.0.0/108")
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	tests := []struct {
+		addr     string
+		contains bool
+	}{
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"172.16.1.1", true},
+		{"172.32.1.1", false},
+	}
+	for _, tt := range tests {
+		if want, got := tt.contains, s.Contains(netip.MustParseAddr(tt.addr)); want != got {
+			t.Fatalf("%s: want=%t, got=%t", tt.addr, want, got)
+		}
+	}
+	if want, got := false, (*proxyheaders.PrefixSet)(nil).Contains(netip.MustParseAddr("10.0.0.1")); want != got {
+		t.Fatalf("want=%t, got=%t", want, got)
+	}
+
+	if _, err := proxyheaders.ParsePrefixSet("10.0.0.0/33"); err == nil {
+		t.Fatalf("want!=nil, got=nil")
+	}
+}
+
+func TestConfig_NewProxiedRequest_trustedProxies(t *testing.T) {
+	c := &proxyheaders.Config{TrustedProxies: proxyheaders.NewPrefixSet(netip.MustParsePrefix("10.0.0.0/8"))}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Add("X-Forwarded-For", "6.6.6.6, 1.2.3.4, 10.0.0.2")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "1.2.3.4", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Add("X-Forwarded-For", "10.0.0.3, 10.0.0.2")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "10.0.0.3", pr.RemoteAddr; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.Header.Add("X-Forwarded-For", "6.6.6.6")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := (*http.Request)(nil), pr; want != got {
+		t.Fatalf("want=nil, got!=nil")
+	}
+	if want, got := proxyheaders.ErrProxyMustBeTrusted, err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+}
+
+func TestConfig_NewProxiedRequest_allowedHosts(t *testing.T) {
+	c := &proxyheaders.Config{AllowedHosts: []string{"www.example.com", "*.example.org", "10.0.0.1"}}
+
+	for _, host := range []string{"www.example.com", "WWW.EXAMPLE.COM:8443", "api.example.org", "a.b.example.org", "10.0.0.1:80"} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", host)
+		req.Header.Add("X-Forwarded-Proto", "https")
+		if _, err := c.NewProxiedRequest(req); err != nil {
+			t.Fatalf("%s: want=nil, got=%v", host, err)
+		}
+	}
+	for _, host := range []string{"example.com", "evil.com", "example.org", "evilexample.org", "10.0.0.2"} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", host)
+		req.Header.Add("X-Forwarded-Proto", "https")
+		_, err := c.NewProxiedRequest(req)
+		if !errors.Is(err, proxyheaders.ErrHostMustBeAllowed) {
+			t.Fatalf("%s: want=%v, got=%v", host, proxyheaders.ErrHostMustBeAllowed, err)
+		}
+	}
+}
+
+func TestConfig_NewProxiedRequest_clientCAs(t *testing.T) {
+	ca, caKey := newCert(t, "Root CA", true, nil, nil)
+	intermediate, intermediateKey := newCert(t, "Intermediate CA", true, ca, caKey)
+	client, _ := newCert(t, "John Doe", false, intermediate, intermediateKey)
+	other, _ := newCert(t, "Other", false, nil, nil)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	c := &proxyheaders.Config{ClientCAs: pool}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Client-Cert", pemEncode(client, intermediate))
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := 1, len(pr.TLS.VerifiedChains); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Client-Cert", pemEncode(other))
+	pr, err = c.NewProxiedRequest(req)
+	if want, got := (*http.Request)(nil), pr; want != got {
+		t.Fatalf("want=nil, got!=nil")
+	}
+	if !errors.Is(err, proxyheaders.ErrXForwardedClientCertMustBeVerified) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrXForwardedClientCertMustBeVerified, err)
+	}
+}
+
+func TestConfig_NewProxiedRequest_clientCRLs(t *testing.T) {
+	ca, caKey := newCert(t, "Root CA", true, nil, nil)
+	client, _ := newCert(t, "John Doe", false, ca, caKey)
+	revoked, _ := newCert(t, "Jane Doe", false, ca, caKey)
+	other, otherKey := newCert(t, "Other CA", true, nil, nil)
+
+	newCRL := func(issuer *x509.Certificate, key *ecdsa.PrivateKey, serial *big.Int, nextUpdate time.Time) *x509.RevocationList {
+		der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:                    big.NewInt(1),
+			ThisUpdate:                nextUpdate.Add(-2 * time.Hour),
+			NextUpdate:                nextUpdate,
+			RevokedCertificateEntries: []x509.RevocationListEntry{{SerialNumber: serial, RevocationTime: time.Now()}},
+		}, issuer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crl
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	c := &proxyheaders.Config{
+		ClientCAs: pool,
+		//The CRL of another issuer listing the client serial is not applied.
+		ClientCRLs: []*x509.RevocationList{newCRL(ca, caKey, revoked.SerialNumber, time.Now().Add(time.Hour)), newCRL(other, otherKey, client.SerialNumber, time.Now().Add(time.Hour))},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Client-Cert", pemEncode(client))
+	if _, err := c.NewProxiedRequest(req); err != nil {
+		t.Fatalf("want=nil, got=%v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Client-Cert", pemEncode(revoked))
+	if _, err := c.NewProxiedRequest(req); !errors.Is(err, proxyheaders.ErrXForwardedClientCertMustNotBeRevoked) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrXForwardedClientCertMustNotBeRevoked, err)
+	}
+
+	//A stale CRL does not tell if the client was revoked since.
+	c.ClientCRLs = []*x509.RevocationList{newCRL(ca, caKey, revoked.SerialNumber, time.Now().Add(-time.Hour))}
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Add("X-Forwarded-For", "1.2.3.4")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Client-Cert", pemEncode(client))
+	if _, err := c.NewProxiedRequest(req); !errors.Is(err, proxyheaders.ErrXForwardedClientCertMustBeVerified) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrXForwardedClientCertMustBeVerified, err)
+	}
+}
+
+func TestConfig_NewProxiedRequest_reportOnly(t *testing.T) {
+	c := &proxyheaders.Config{
+		TrustedProxies: proxyheaders.NewPrefixSet(netip.MustParsePrefix("10.0.0.0/8")),
+		AllowedHosts:   []string{"www.example.com"},
+		ReportOnly:     true,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.Header.Add("X-Forwarded-For", "6.6.6.6")
+	req.Header.Add("X-Forwarded-Host", "evil.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	pr, err := c.NewProxiedRequest(req)
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "evil.example.com", pr.Host; want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	violations := proxyheaders.Violations(pr)
+	if want, got := 2, len(violations); want != got {
+		t.Fatalf("want=%d, got=%d", want, got)
+	}
+	if want, got := proxyheaders.ErrProxyMustBeTrusted, violations[0]; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if !errors.Is(violations[1], proxyheaders.ErrHostMustBeAllowed) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrHostMustBeAllowed, violations[1])
+	}
+
+	//Malformed headers are not policy violations, they still fail.
+	req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Add("X-Forwarded-For", "6.6.6.6")
+	req.Header.Add("X-Forwarded-Host", "www.example.com")
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Proto", "gopher")
+	if _, err := c.NewProxiedRequest(req); !errors.Is(err, proxyheaders.ErrXForwardedProtoMustBeValid) {
+		t.Fatalf("want=%v, got=%v", proxyheaders.ErrXForwardedProtoMustBeValid, err)
+	}
+}
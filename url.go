@@ -0,0 +1,142 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//ExternalOrigin returns the origin ("scheme://host[:port]") the client used to reach the proxy, based on a request returned by
+//NewProxiedRequest. The default port of the scheme is omitted.
+//
+//If r was not processed by NewProxiedRequest the origin is derived from the request itself, so the function is also usable with
+//direct (not proxied) requests.
+func ExternalOrigin(r *http.Request) string {
+	scheme := requestScheme(r)
+	return scheme + "://" + stripDefaultPort(r.Host, scheme)
+}
+
+//ExternalPrefix returns the path prefix removed by the proxy, as informed in X-Forwarded-Prefix, without trailing slash.
+//If there is no prefix it returns an empty string.
+func ExternalPrefix(r *http.Request) string {
+	f := forwardedFrom(r)
+	if f == nil {
+		return ""
+	}
+	return f.prefix
+}
+
+//ExternalURL resolves ref into the absolute URL the client must use to reach it through the proxy.
+//
+//An absolute ref (with scheme) is returned as is. A ref starting with "/" is relative to the application root, so it is
+//placed after the forwarded prefix. Any other ref is resolved relatively to the external URL of the request itself.
+//
+//Eg.: for a request forwarded with X-Forwarded-Proto "https", X-Forwarded-Host "www.example.com" and X-Forwarded-Prefix "/app",
+//the ref "/oauth/callback" resolves to "https://www.example.com/app/oauth/callback".
+func ExternalURL(r *http.Request, ref string) (*url.URL, error) {
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	if refURL.IsAbs() {
+		return refURL, nil
+	}
+
+	scheme := requestScheme(r)
+	prefix := ExternalPrefix(r)
+	base := &url.URL{
+		Scheme: scheme,
+		Host:   stripDefaultPort(r.Host, scheme),
+		Path:   prefix + r.URL.Path,
+	}
+	if refURL.Host == "" && strings.HasPrefix(refURL.Path, "/") {
+		refURL.Path = prefix + refURL.Path
+		if refURL.RawPath != "" {
+			refURL.RawPath = prefix + refURL.RawPath
+		}
+	}
+	return base.ResolveReference(refURL), nil
+}
+
+//requestScheme returns the scheme the client used, either from the URL made absolute by NewProxiedRequest or by the request TLS.
+func requestScheme(r *http.Request) string {
+	if r.URL != nil && r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+//defaultPort returns the port implied by a scheme.
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "https", "wss":
+		return "443"
+	}
+	return "80"
+}
+
+//stripDefaultPort removes the port from host if it is the default port for the scheme.
+func stripDefaultPort(host, scheme string) string {
+	h, p, err := net.SplitHostPort(host)
+	if err != nil || p != defaultPort(scheme) {
+		return host
+	}
+	if strings.Contains(h, ":") {
+		return "[" + h + "]"
+	}
+	return h
+}
+
+//joinForwardedPort appends the forwarded port to the forwarded host, unless the host already has a port or the port is the
+//default for the scheme.
+func joinForwardedPort(host, port, scheme string) (string, error) {
+	if port == "" {
+		return host, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(port))
+	if err != nil || n < 1 || n > 65535 {
+		return "", ErrXForwardedPortMustBeValid
+	}
+	port = strconv.Itoa(n)
+	if _, _, err := net.SplitHostPort(host); err == nil || port == defaultPort(scheme) {
+		return host, nil
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port), nil
+}
+
+//parsePrefix validates the X-Forwarded-Prefix, returning it without the trailing slashes.
+func parsePrefix(prefix string) (string, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "//") || strings.ContainsAny(prefix, "?#\\") {
+		return "", ErrXForwardedPrefixMustBeValid
+	}
+	for _, c := range prefix {
+		if c < 0x20 || c == 0x7f {
+			return "", ErrXForwardedPrefixMustBeValid
+		}
+	}
+	return strings.TrimRight(prefix, "/"), nil
+}
@@ -0,0 +1,118 @@
+// This file is part of Gopher Burrow Proxy Headers Utilities.
+//
+// Gopher Burrow Proxy Headers Utilities is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Gopher Burrow Proxy Headers Utilities is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with Gopher Burrow Proxy Headers Utilities.  If not, see <http://www.gnu.org/licenses/>.
+
+package proxyheaders_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/gopherburrow/proxyheaders"
+)
+
+func TestExternalURL(t *testing.T) {
+	tests := []struct {
+		proto, host, port, prefix string
+		path                      string
+		ref                       string
+		origin                    string
+		url                       string
+	}{
+		{"https", "www.example.com", "", "", "/", "/callback", "https://www.example.com", "https://www.example.com/callback"},
+		{"https", "www.example.com", "443", "", "/", "/callback", "https://www.example.com", "https://www.example.com/callback"},
+		{"https", "www.example.com", "8443", "", "/", "/callback", "https://www.example.com:8443", "https://www.example.com:8443/callback"},
+		{"http", "www.example.com:80", "", "", "/", "/callback", "http://www.example.com", "http://www.example.com/callback"},
+		{"http", "www.example.com:8080", "9090", "", "/", "/", "http://www.example.com:8080", "http://www.example.com:8080/"},
+		{"https", "[2001:db8::1]", "8443", "", "/", "/x", "https://[2001:db8::1]:8443", "https://[2001:db8::1]:8443/x"},
+		{"https", "[2001:db8::1]:443", "", "", "/", "/x", "https://[2001:db8::1]", "https://[2001:db8::1]/x"},
+		{"https", "www.example.com", "", "/app/", "/users/1", "/oauth/callback?a=b", "https://www.example.com", "https://www.example.com/app/oauth/callback?a=b"},
+		{"https", "www.example.com", "", "/app", "/users/1", "2", "https://www.example.com", "https://www.example.com/app/users/2"},
+		{"https", "www.example.com", "", "/app", "/users/1", "?page=2", "https://www.example.com", "https://www.example.com/app/users/1?page=2"},
+		{"wss", "www.example.com", "443", "", "/", "/socket", "wss://www.example.com", "wss://www.example.com/socket"},
+		{"https", "www.example.com", "", "/app", "/", "http://other.example.com/x", "https://www.example.com", "http://other.example.com/x"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+tt.path, nil)
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", tt.host)
+		req.Header.Add("X-Forwarded-Proto", tt.proto)
+		if tt.port != "" {
+			req.Header.Add("X-Forwarded-Port", tt.port)
+		}
+		if tt.prefix != "" {
+			req.Header.Add("X-Forwarded-Prefix", tt.prefix)
+		}
+
+		pr, err := proxyheaders.NewProxiedRequest(req)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("want=%v, got=%v", want, got)
+		}
+		if want, got := tt.origin, proxyheaders.ExternalOrigin(pr); want != got {
+			t.Fatalf("want=%s, got=%s", want, got)
+		}
+		u, err := proxyheaders.ExternalURL(pr, tt.ref)
+		if want, got := error(nil), err; want != got {
+			t.Fatalf("want=%v, got=%v", want, got)
+		}
+		if want, got := tt.url, u.String(); want != got {
+			t.Fatalf("want=%s, got=%s", want, got)
+		}
+	}
+}
+
+func TestExternalURL_direct(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://www.example.com/a/b", nil)
+	if want, got := "https://www.example.com", proxyheaders.ExternalOrigin(req); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+	u, err := proxyheaders.ExternalURL(req, "c")
+	if want, got := error(nil), err; want != got {
+		t.Fatalf("want=%v, got=%v", want, got)
+	}
+	if want, got := "https://www.example.com/a/c", u.String(); want != got {
+		t.Fatalf("want=%s, got=%s", want, got)
+	}
+}
+
+func TestNewProxiedRequest_failInvalidXForwardedPortAndPrefix(t *testing.T) {
+	tests := []struct {
+		header, value string
+		err           error
+	}{
+		{"X-Forwarded-Port", "https", proxyheaders.ErrXForwardedPortMustBeValid},
+		{"X-Forwarded-Port", "0", proxyheaders.ErrXForwardedPortMustBeValid},
+		{"X-Forwarded-Port", "65536", proxyheaders.ErrXForwardedPortMustBeValid},
+		{"X-Forwarded-Prefix", "app", proxyheaders.ErrXForwardedPrefixMustBeValid},
+		{"X-Forwarded-Prefix", "//evil.example.com", proxyheaders.ErrXForwardedPrefixMustBeValid},
+		{"X-Forwarded-Prefix", "/app?x=1", proxyheaders.ErrXForwardedPrefixMustBeValid},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		req.Header.Add("X-Forwarded-For", "1.2.3.4")
+		req.Header.Add("X-Forwarded-Host", "www.example.com")
+		req.Header.Add("X-Forwarded-Proto", "https")
+		req.Header.Add(tt.header, tt.value)
+
+		pr, err := proxyheaders.NewProxiedRequest(req)
+		if want, got := (*http.Request)(nil), pr; want != got {
+			t.Fatalf("want=nil, got!=nil")
+		}
+		if want, got := tt.err, err; !errors.Is(got, want) {
+			t.Fatalf("%s=%q: want=%q, got=%q", tt.header, tt.value, want, got)
+		}
+	}
+}